@@ -1,142 +1,102 @@
 package main
 
 import (
-	"fmt"
-	"database/sql"
-	"log"
-	"github.com/rs/xid"
+	"context"
+	"log/slog"
 )
 
-type KatExpression func(*sql.Tx) bool
+type KatExpression func(Executor) bool
 
-var ( LogMessage (func(string)) = func(msg string){
-		log.Print(msg)
-	}
-
-	LogError (func(error) bool) = func(err error) bool {
-		if err != nil {
-			log.Print(err)
-			return false
-		} else {
-			return true
-		}
-	}
-)
-
-func Zero(*sql.Tx) bool { return false }
+func Zero(Executor) bool { return false }
 
 func And(args ... KatExpression) (KatExpression) {
-	return func(tx *sql.Tx) bool {
+	return tracedBool("And", func(tx Executor) bool {
 		for _, op := range args {
 			if (!op(tx)){
 				return false
 			}
 		}
 		return true
-	}
+	})
 }
 
 func Or(args ... KatExpression) (KatExpression) {
-	return func(tx *sql.Tx) bool {
+	return tracedBool("Or", func(tx Executor) bool {
+		var ctx = contextOf(tx)
+		savepoint, r := BeginSavepoint(ctx, tx)
+		if !r.Ok() {
+			return false
+		}
 		result := true
-		var salt = xid.New()
-		LogMessage(fmt.Sprintf("savepoint %s", salt))
-		tx.Exec(fmt.Sprintf("savepoint %s", salt))
 		for _, op := range args {
 			result = op(tx)
 			if result {
 				break
-			} else {
-				LogMessage(fmt.Sprintf("rollback to savepoint %s", salt))
-				tx.Exec(fmt.Sprintf("rollback to savepoint %s", salt))
+			} else if !savepoint.RollbackTo(ctx).Ok() {
+				return false
 			}
 		}
-		return result
-	}
+		return savepoint.Release(ctx).Ok() && result
+	})
 }
 
 func Star(op KatExpression) (KatExpression) {
-	return func(tx *sql.Tx) bool {
-		for {   var salt = xid.New()
-			LogMessage(fmt.Sprintf("savepoint %s", salt))
-			tx.Exec(fmt.Sprintf("savepoint %s", salt))
+	return tracedBool("Star", func(tx Executor) bool {
+		var ctx = contextOf(tx)
+		for {
+			savepoint, r := BeginSavepoint(ctx, tx)
+			if !r.Ok() {
+				return false
+			}
 			if (!op(tx)){
-				LogMessage(fmt.Sprintf("rollback to savepoint %s", salt))
-				tx.Exec(fmt.Sprintf("rollback %s", salt))
-				return true
+				return savepoint.Discard(ctx).Ok()
+			}
+			if !savepoint.Release(ctx).Ok() {
+				return false
 			}
 		}
-
-	}
+	})
 }
 
 func Not(op KatExpression) (KatExpression) {
-	return func(tx *sql.Tx) bool {
+	return tracedBool("Not", func(tx Executor) bool {
 		return ! op(tx)
-	}
+	})
 }
 
-var One KatExpression = Not(Zero)
+/* not Not(Zero) so that One leaves no trace */
+var One KatExpression = func(Executor) bool { return true }
 
+/* errors opening, committing or rolling back are logged, so is a result that is an error or a cancellation */
 func Eval(driverName string, dataSourceName string,expression KatExpression) {
-	db, err := sql.Open(driverName, dataSourceName)
-	LogError(err)
-	tx, err := db.Begin()
-	defer db.Close()
-	if LogError(err) {
-		if expression(tx) {
-			LogError(tx.Commit())
-		} else {
-			LogError(tx.Rollback())
-		}
+	EvalLogged(context.Background(),driverName,dataSourceName,expression)
+}
+
+func EvalLogged(ctx context.Context, driverName string, dataSourceName string,expression KatExpression) {
+	var report = EvalOpen(ctx,driverName,dataSourceName,LiftContext(expression))
+	if report.Err != nil {
+		LoggerOf(ctx).Error("Eval",slog.String("error",report.Err.Error()))
+	} else {
+		logResult(ctx,"Eval",report.Result)
 	}
 }
 
 func ExecuteSQL(statement string, args ...interface{}) KatExpression {
-	return func(tx *sql.Tx) bool {
-		LogMessage(fmt.Sprintf("ExecuteSQL: %v %v\n", statement,args))
-		_, err := tx.Exec(statement,args...)
-		return LogError(err)
+	return func(tx Executor) bool {
+		return ExecuteSQLContext(statement,args...)(contextOf(tx),tx).Ok()
 	}
 }
 
 func ExecuteQuery(query string, args ...interface{}) func(...interface{}) KatExpression {
 	return func(dest ...interface{}) KatExpression {
-		return func(tx *sql.Tx) bool {
-			rows, err := tx.Query(query,args...)
-			LogMessage(fmt.Sprintf("ExecuteQuery: %v %v\n", query,args))
-			if err != nil {
-				return LogError(err)
-			}
-			defer rows.Close()
-			if rows.Next() {
-				if err := rows.Scan(dest...); err != nil {
-					return LogError(err)
-				}
-			} else {
-				return LogError(rows.Err()) && false
-			}
-			return LogError(rows.Err())
+		return func(tx Executor) bool {
+			return ExecuteQueryContext(query,args...)(dest...)(contextOf(tx),tx).Ok()
 		}
 	}
 }
 
-func HandleQuery(query string, args ...interface{}) func(*sql.Tx,func(),...interface{}) bool {
-	return func(tx *sql.Tx,handler func(),dest ...interface{}) bool {
-		LogMessage(fmt.Sprintf("HandleQuery: %v %v\n", query,args))
-
-		rows, err := tx.Query(query,args...)
-		if err != nil {
-			return LogError(err)
-		}
-		defer rows.Close()
-		for rows.Next() {
-			if err := rows.Scan(dest...); err != nil {
-				return LogError(err)
-			} else {
-				handler()
-			}
-		}
-		return LogError(rows.Err())
+func HandleQuery(query string, args ...interface{}) func(Executor,func(),...interface{}) bool {
+	return func(tx Executor,handler func(),dest ...interface{}) bool {
+		return HandleQueryContext(query,args...)(contextOf(tx),tx,handler,dest...).Ok()
 	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+)
+
+/*
+ conditionals. Unlike Or a guard is evaluated once and the failure of
+ the chosen branch is the failure of the conditional, it never falls
+ through to another branch. Guards and branches run in their own
+ savepoints so a failed guard or branch leaves no side effects.
+*/
+
+type CaseBranch struct {
+	Guard KatContextExpression
+	Then  KatContextExpression
+}
+
+func When(guard KatContextExpression, then KatContextExpression) CaseBranch {
+	return CaseBranch{guard, then}
+}
+
+/* a branch that is always chosen, put it last */
+func Otherwise(then KatContextExpression) CaseBranch {
+	return CaseBranch{OneContext, then}
+}
+
+/* runs the branch of the first guard that holds, fails when none does */
+func Case(branches ... CaseBranch) (KatContextExpression) {
+	return traced("Case", func(ctx context.Context, tx Executor) Result {
+		for _, branch := range branches {
+			if err := ctx.Err(); err != nil {
+				return Interrupted("Case", err)
+			}
+			var guard = inSavepoint(ctx, tx, branch.Guard)
+			if guard.Ok() {
+				return inSavepoint(ctx, tx, branch.Then)
+			} else if guard.Kind != TestFailed {
+				return guard
+			}
+		}
+		return Failed("Case")
+	})
+}
+
+func IfThenElseContext(test KatContextExpression, then KatContextExpression, otherwise KatContextExpression) (KatContextExpression) {
+	return Case(When(test, then), Otherwise(otherwise))
+}
+
+func IfThenElse(test KatExpression, then KatExpression, otherwise KatExpression) (KatExpression) {
+	return LowerContext(IfThenElseContext(LiftContext(test), LiftContext(then), LiftContext(otherwise)))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"database/sql"
+)
+
+func counted(count *int,result Result) KatContextExpression {
+	return func(ctx context.Context,tx Executor) Result {
+		*count = *count + 1
+		return result
+	}
+}
+
+func TestIfThenElseNoFallThrough(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var tests, thens, elses = 0, 0, 0
+	var result = IfThenElseContext(counted(&tests,Passed()),counted(&thens,Failed("then")),counted(&elses,Passed()))(context.Background(),fake)
+	if result.Kind != TestFailed || result.Step != "then" {
+		t.Errorf("if : expected the then failure got %v",result)
+	}
+	if tests != 1 || thens != 1 || elses != 0 {
+		t.Errorf("if : expected test and then once got %v %v %v",tests,thens,elses)
+	}
+	result = IfThenElseContext(counted(&tests,Failed("test")),counted(&thens,Passed()),counted(&elses,Passed()))(context.Background(),fake)
+	if !result.Ok() || tests != 2 || thens != 1 || elses != 1 {
+		t.Errorf("if : expected else once got %v %v %v %v",result,tests,thens,elses)
+	}
+}
+
+func TestIfThenElseBool(t *testing.T) {
+	var fake = NewFakeExecutor()
+	if !IfThenElse(Zero,Zero,One)(fake) || IfThenElse(One,Zero,One)(fake) {
+		t.Errorf("if : expected the branch of the test")
+	}
+}
+
+func TestCase(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var first, second = 0, 0
+	var result = Case(When(ZeroContext,counted(&first,Passed())),
+		          When(OneContext,counted(&second,Passed())))(context.Background(),fake)
+	if !result.Ok() || first != 0 || second != 1 {
+		t.Errorf("case : expected the second branch got %v %v %v",result,first,second)
+	}
+	result = Case(When(ZeroContext,OneContext))(context.Background(),fake)
+	if result.Kind != TestFailed || result.Step != "Case" {
+		t.Errorf("case : expected no branch to fail got %v",result)
+	}
+	result = Case(When(counted(&first,Faulted("guard",errors.New("guard"))),OneContext),
+		      Otherwise(counted(&second,Passed())))(context.Background(),fake)
+	if result.Kind != Errored || second != 1 {
+		t.Errorf("case : expected guard error to stop got %v %v",result,second)
+	}
+}
+
+func TestCaseRollsBack(t *testing.T) {
+	var total = -1
+	var insert = func(n int) KatContextExpression {
+		return ExecuteSQLContext("insert into c (c) VALUES (?)",n)
+	}
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,ExecuteSQLContext("create table c (c integer)"))
+		var report = EvalDB(context.Background(),db,AndContext(Case(When(AndContext(insert(1),ZeroContext),insert(2)),
+			                                                    Otherwise(insert(3))),
+			                                               IfThenElseContext(OneContext,AndContext(insert(4),ZeroContext),insert(5))))
+		if report.Result.Kind != TestFailed {
+			t.Errorf("case : expected the failed then branch got %v",report.Result)
+		}
+		report = EvalDB(context.Background(),db,AndContext(Case(When(AndContext(insert(1),ZeroContext),insert(2)),
+			                                                    Otherwise(insert(3))),
+			                                               ExecuteQueryContext("select sum(c) from c")(&total)))
+		if !report.Committed || total != 3 {
+			t.Errorf("case : expected only the otherwise branch got %v %v",report,total)
+		}
+	})
+}
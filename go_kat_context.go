@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type KatContextExpression func(context.Context, Executor) Result
+
+/* a failure caused by the context is reported as cancelled rather than as a driver error */
+func contextFault(ctx context.Context, step string, err error) Result {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Interrupted(step, ctxErr)
+	}
+	return Faulted(step, err)
+}
+
+/* carries the context through the context free forms */
+type contextExecutor struct {
+	Executor
+	ctx context.Context
+}
+
+func withContext(ctx context.Context, tx Executor) Executor {
+	if inner, ok := tx.(*contextExecutor); ok {
+		tx = inner.Executor
+	}
+	return &contextExecutor{tx, ctx}
+}
+
+/* the context of the evaluation tx belongs to, the background context outside one */
+func contextOf(tx Executor) context.Context {
+	if inner, ok := tx.(*contextExecutor); ok {
+		return inner.ctx
+	}
+	return context.Background()
+}
+
+/* adapters to and from the context free forms */
+func Contextual(op KatResultExpression) (KatContextExpression) {
+	return func(ctx context.Context, tx Executor) Result {
+		return op(withContext(ctx, tx))
+	}
+}
+
+func Background(op KatContextExpression) (KatResultExpression) {
+	return func(tx Executor) Result {
+		return op(contextOf(tx), tx)
+	}
+}
+
+func LiftContext(op KatExpression) (KatContextExpression) {
+	return Contextual(Lift(op))
+}
+
+func LowerContext(op KatContextExpression) (KatExpression) {
+	return Lower(Background(op))
+}
+
+func contextualAll(args []KatResultExpression) []KatContextExpression {
+	var result = make([]KatContextExpression, len(args))
+	for i, op := range args {
+		result[i] = Contextual(op)
+	}
+	return result
+}
+
+func ZeroContext(context.Context, Executor) Result { return Failed("Zero") }
+
+func AndContext(args ... KatContextExpression) (KatContextExpression) {
+	return traced("And", func(ctx context.Context, tx Executor) Result {
+		for _, op := range args {
+			if err := ctx.Err(); err != nil {
+				return Interrupted("And", err)
+			}
+			if r := op(ctx, tx); !r.Ok() {
+				return r
+			}
+		}
+		return Passed()
+	})
+}
+
+func OrContext(args ... KatContextExpression) (KatContextExpression) {
+	return choice(args, nil)
+}
+
+/*
+ a read-only branch that failed its test has nothing to roll back, the
+ savepoint is opened lazily before the first branch that may write so
+ a choice decided by tests opens none. An error in a read-only branch
+ before the savepoint ends the choice : there is no savepoint to
+ recover a transaction the database aborted, as PostgreSQL does on
+ any error. An error after the savepoint is rolled back to it and the
+ next branch tried.
+*/
+func choice(args []KatContextExpression, effects []Effect) KatContextExpression {
+	var readOnly = func(i int) bool { return i < len(effects) && effects[i] == ReadOnly }
+	return traced("Or", func(ctx context.Context, tx Executor) Result {
+		var savepoint *Savepoint
+		var result = Passed()
+		for i, op := range args {
+			if err := ctx.Err(); err != nil {
+				return Interrupted("Or", err)
+			}
+			if savepoint == nil && !readOnly(i) {
+				if savepoint, result = BeginSavepoint(ctx, tx); !result.Ok() {
+					return result
+				}
+			}
+			result = op(ctx, tx)
+			if result.Ok() {
+				break
+			} else if result.Kind == Cancelled || (savepoint == nil && result.Kind == Errored) {
+				return result
+			}
+			if readOnly(i) && result.Kind == TestFailed {
+				continue
+			}
+			if r := savepoint.RollbackTo(ctx); !r.Ok() {
+				return r
+			}
+		}
+		if savepoint != nil {
+			if r := savepoint.Release(ctx); !r.Ok() {
+				return r
+			}
+		}
+		return result
+	})
+}
+
+func StarContext(op KatContextExpression) (KatContextExpression) {
+	return starLoop("Star", nil, op, unbounded, nil)
+}
+
+func NotContext(op KatContextExpression) (KatContextExpression) {
+	return traced("Not", func(ctx context.Context, tx Executor) Result {
+		var r = op(ctx, tx)
+		switch r.Kind {
+		case Success:
+			return Failed("Not")
+		case TestFailed:
+			return Passed()
+		}
+		return r
+	})
+}
+
+var OneContext KatContextExpression = NotContext(ZeroContext)
+
+func EvalContext(ctx context.Context, driverName string, dataSourceName string, expression KatContextExpression) Result {
+	return EvalOpen(ctx, driverName, dataSourceName, expression).Result
+}
+
+func ExecuteSQLContext(statement string, args ...interface{}) KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var step = fmt.Sprintf("ExecuteSQL: %v %v", statement, args)
+		return traceStep(ctx, "ExecuteSQL", append([]interface{}{statement}, args...), func() Result {
+			if _, err := tx.Exec(ctx, statement, args...); err != nil {
+				return contextFault(ctx, step, err)
+			}
+			return Passed()
+		})
+	}
+}
+
+func ExecuteQueryContext(query string, args ...interface{}) func(...interface{}) KatContextExpression {
+	return func(dest ...interface{}) KatContextExpression {
+		return func(ctx context.Context, tx Executor) Result {
+			var step = fmt.Sprintf("ExecuteQuery: %v %v", query, args)
+			return traceStep(ctx, "ExecuteQuery", append([]interface{}{query}, args...), func() Result {
+				rows, err := tx.Query(ctx, query, args...)
+				if err != nil {
+					return contextFault(ctx, step, err)
+				}
+				defer rows.Close()
+				if !rows.Next() {
+					if err := rows.Err(); err != nil {
+						return contextFault(ctx, step, err)
+					}
+					return Failed(step)
+				}
+				if err := rows.Scan(dest...); err != nil {
+					return contextFault(ctx, step, err)
+				}
+				if err := rows.Err(); err != nil {
+					return contextFault(ctx, step, err)
+				}
+				return Passed()
+			})
+		}
+	}
+}
+
+func HandleQueryContext(query string, args ...interface{}) func(context.Context, Executor, func(), ...interface{}) Result {
+	return func(ctx context.Context, tx Executor, handler func(), dest ...interface{}) Result {
+		var step = fmt.Sprintf("HandleQuery: %v %v", query, args)
+		return traceStep(ctx, "HandleQuery", append([]interface{}{query}, args...), func() Result {
+			rows, err := tx.Query(ctx, query, args...)
+			if err != nil {
+				return contextFault(ctx, step, err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				if err := ctx.Err(); err != nil {
+					return Interrupted(step, err)
+				}
+				if err := rows.Scan(dest...); err != nil {
+					return contextFault(ctx, step, err)
+				}
+				handler()
+			}
+			if err := rows.Err(); err != nil {
+				return contextFault(ctx, step, err)
+			}
+			return Passed()
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"time"
+)
+
+func assertContext(t *testing.T,msg string,expected ResultKind,k KatContextExpression) KatContextExpression {
+	return func(ctx context.Context,tx Executor) Result {
+		result := k(ctx,tx)
+		if result.Kind != expected {
+			t.Errorf("%s : expected %v got %v",msg,expected,result)
+		}
+		return result
+	}
+}
+
+func TestContextLogic(t *testing.T) {
+	var ctx = context.Background()
+	assertContext(t,"context : zero",TestFailed,ZeroContext)(ctx,nil)
+	assertContext(t,"context : one",Success,OneContext)(ctx,nil)
+	assertContext(t,"context : and 1 0",TestFailed,AndContext(OneContext,ZeroContext))(ctx,nil)
+	assertContext(t,"context : lift one",Success,LiftContext(One))(ctx,nil)
+	assertResult(t,"context : background one",Success,Background(OneContext))(nil)
+}
+
+func TestContextCancelledBeforeEval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalContext(ctx,"sqlite3",tmpfile,OneContext)
+		if result.Kind != Cancelled || !errors.Is(result.Err,context.Canceled) {
+			t.Errorf("context : expected cancelled got %v",result)
+		}
+	})
+}
+
+func TestContextCancelStopsStar(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var count = 0
+	var insert = ExecuteSQLContext("insert into s (s) VALUES (1)")
+	var insertThenCancel = func(ctx context.Context,tx Executor) Result {
+		count = count + 1
+		if count == 3 {
+			cancel()
+		}
+		return insert(ctx,tx)
+	}
+	var createTable = ExecuteSQLContext("create table s (s integer)")
+	var total = -1
+	WithTestFile(t,func(tmpfile string){
+		EvalContext(context.Background(),"sqlite3",tmpfile,createTable)
+		var result = EvalContext(ctx,"sqlite3",tmpfile,StarContext(insertThenCancel))
+		if result.Kind != Cancelled {
+			t.Errorf("context : expected star cancelled got %v",result)
+		}
+		if count != 3 {
+			t.Errorf("context : expected star to stop after 3 got %v",count)
+		}
+		EvalContext(context.Background(),"sqlite3",tmpfile,ExecuteQueryContext("select count(*) from s")(&total))
+		if total != 0 {
+			t.Errorf("context : expected cancelled star to roll back got %v rows",total)
+		}
+	})
+}
+
+func TestContextCancelStopsOr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reached = false
+	var cancelAndFail = func(ctx context.Context,tx Executor) Result {
+		cancel()
+		return Failed("cancelAndFail")
+	}
+	var next = func(ctx context.Context,tx Executor) Result {
+		reached = true
+		return Passed()
+	}
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalContext(ctx,"sqlite3",tmpfile,OrContext(cancelAndFail,next))
+		if result.Kind != Cancelled || reached {
+			t.Errorf("context : expected or to stop on cancel got %v",result)
+		}
+	})
+}
+
+func TestContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(),time.Millisecond)
+	defer cancel()
+	var wait = func(ctx context.Context,tx Executor) Result {
+		<-ctx.Done()
+		return Passed()
+	}
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalContext(ctx,"sqlite3",tmpfile,AndContext(wait,ExecuteSQLContext("create table d (d integer)")))
+		if result.Kind != Cancelled || !errors.Is(result.Err,context.DeadlineExceeded) {
+			t.Errorf("context : expected deadline got %v",result)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+/*
+ SQL that differs between databases. Statements are written with ?
+ placeholders and rebound to the dialect when they are executed.
+*/
+type Dialect interface {
+	Name() string
+	Savepoint(name string) string
+	RollbackTo(name string) string
+	Release(name string) string
+	Rebind(query string) string
+	Upsert(table string, keys []string, columns []string) string
+	AutoIncrement(column string) string
+}
+
+/* savepoints are standard SQL for all three */
+type standardSavepoints struct{}
+
+type SQLiteDialect struct{ standardSavepoints }
+
+type PostgresDialect struct{ standardSavepoints }
+
+type MySQLDialect struct{ standardSavepoints }
+
+func (standardSavepoints) Savepoint(name string) string { return "savepoint " + name }
+
+func (standardSavepoints) RollbackTo(name string) string { return "rollback to savepoint " + name }
+
+func (standardSavepoints) Release(name string) string { return "release savepoint " + name }
+
+func (SQLiteDialect) Name() string { return "sqlite3" }
+
+func (SQLiteDialect) Rebind(query string) string { return query }
+
+func (SQLiteDialect) Upsert(table string, keys []string, columns []string) string {
+	return insertInto(table, keys, columns) + onConflict(keys, columns)
+}
+
+func (SQLiteDialect) AutoIncrement(column string) string { return column + " integer primary key autoincrement" }
+
+func (PostgresDialect) Name() string { return "postgres" }
+
+/* ? becomes $1, $2 ... outside of quoted strings, comments and dollar quoted strings */
+func (PostgresDialect) Rebind(query string) string {
+	var builder strings.Builder
+	var n = 0
+	for i := 0; i < len(query); {
+		if end := skipLiteral(query, i); end > i {
+			builder.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if query[i] == '?' {
+			n++
+			fmt.Fprintf(&builder, "$%d", n)
+		} else {
+			builder.WriteByte(query[i])
+		}
+		i++
+	}
+	return builder.String()
+}
+
+/* the end of the string or comment starting at i, i when none starts there */
+func skipLiteral(query string, i int) int {
+	var rest = query[i:]
+	var end = -1
+	switch {
+	case rest[0] == '\'' || rest[0] == '"':
+		if end = strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+			end += 2
+		}
+	case strings.HasPrefix(rest, "--"):
+		end = strings.IndexByte(rest, '\n')
+	case strings.HasPrefix(rest, "/*"):
+		if end = strings.Index(rest[2:], "*/"); end >= 0 {
+			end += 4
+		}
+	case rest[0] == '$':
+		var tag = dollarTag(rest)
+		if tag == "" {
+			return i
+		}
+		if end = strings.Index(rest[len(tag):], tag); end >= 0 {
+			end += 2 * len(tag)
+		}
+	default:
+		return i
+	}
+	if end < 0 {
+		return len(query)
+	}
+	return i + end
+}
+
+/* the opening $tag$ or $$ of a dollar quoted string, $1 is a parameter */
+func dollarTag(rest string) string {
+	for j := 1; j < len(rest); j++ {
+		var c = rest[j]
+		switch {
+		case c == '$':
+			return rest[:j+1]
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (j > 1 && c >= '0' && c <= '9'):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func (PostgresDialect) Upsert(table string, keys []string, columns []string) string {
+	return insertInto(table, keys, columns) + onConflict(keys, columns)
+}
+
+func (PostgresDialect) AutoIncrement(column string) string { return column + " serial primary key" }
+
+func (MySQLDialect) Name() string { return "mysql" }
+
+func (MySQLDialect) Rebind(query string) string { return query }
+
+func (MySQLDialect) Upsert(table string, keys []string, columns []string) string {
+	var updates = make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+	}
+	var update = " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	if len(columns) == 0 {
+		update = fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s = %s", keys[0], keys[0])
+	}
+	return insertInto(table, keys, columns) + update
+}
+
+func (MySQLDialect) AutoIncrement(column string) string { return column + " integer primary key auto_increment" }
+
+func insertInto(table string, keys []string, columns []string) string {
+	var all = append(append([]string{}, keys...), columns...)
+	var placeholders = strings.TrimSuffix(strings.Repeat("?,", len(all)), ",")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(all, ","), placeholders)
+}
+
+func onConflict(keys []string, columns []string) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(keys, ","))
+	}
+	var updates = make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ","), strings.Join(updates, ", "))
+}
+
+func DialectFor(driverName string) (Dialect, error) {
+	switch driverName {
+	case "sqlite3", "sqlite":
+		return SQLiteDialect{}, nil
+	case "postgres", "pgx":
+		return PostgresDialect{}, nil
+	case "mysql":
+		return MySQLDialect{}, nil
+	}
+	return nil, fmt.Errorf("no dialect for driver %v", driverName)
+}
+
+type dialectKey struct{}
+
+func WithDialect(ctx context.Context, dialect Dialect) context.Context {
+	return context.WithValue(ctx, dialectKey{}, dialect)
+}
+
+/* SQLite unless WithDialect or EvalOpen installed another */
+func DialectOf(ctx context.Context) Dialect {
+	if dialect, ok := ctx.Value(dialectKey{}).(Dialect); ok {
+		return dialect
+	}
+	return SQLiteDialect{}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"database/sql"
+)
+
+func TestDialectFor(t *testing.T) {
+	var cases = map[string]string{"sqlite3" : "sqlite3","postgres" : "postgres","pgx" : "postgres","mysql" : "mysql"}
+	for driver, expected := range cases {
+		dialect, err := DialectFor(driver)
+		if err != nil || dialect.Name() != expected {
+			t.Errorf("dialect : %v expected %v got %v %v",driver,expected,dialect,err)
+		}
+	}
+	if _, err := DialectFor("oracle"); err == nil {
+		t.Errorf("dialect : expected unknown driver error")
+	}
+	if DialectOf(context.Background()).Name() != "sqlite3" {
+		t.Errorf("dialect : expected sqlite by default")
+	}
+	if DialectOf(WithDialect(context.Background(),MySQLDialect{})).Name() != "mysql" {
+		t.Errorf("dialect : expected installed dialect")
+	}
+}
+
+func init() {
+	sql.Register("kat_sqlite",&sqlite3.SQLiteDriver{})
+}
+
+func TestDialectSQL(t *testing.T) {
+	var cases = []struct {
+		got      string
+		expected string
+	}{
+		{SQLiteDialect{}.Savepoint("a"),"savepoint a"},
+		{PostgresDialect{}.RollbackTo("a"),"rollback to savepoint a"},
+		{MySQLDialect{}.Release("a"),"release savepoint a"},
+		{SQLiteDialect{}.Rebind("select ? , ?"),"select ? , ?"},
+		{PostgresDialect{}.Rebind("select ? , ?"),"select $1 , $2"},
+		{PostgresDialect{}.Rebind("select '?' , \"a?\" , ? where a = '''?'"),"select '?' , \"a?\" , $1 where a = '''?'"},
+		{PostgresDialect{}.Rebind("select ? -- why?\n, ? /* a ? b */ , ?"),"select $1 -- why?\n, $2 /* a ? b */ , $3"},
+		{PostgresDialect{}.Rebind("select $$a?$$ , $q$ ? $$ ? $q$ , ? , $1"),"select $$a?$$ , $q$ ? $$ ? $q$ , $1 , $1"},
+		{PostgresDialect{}.Rebind("select ? -- ?"),"select $1 -- ?"},
+		{PostgresDialect{}.Rebind("select '?"),"select '?"},
+		{MySQLDialect{}.Rebind("select ?"),"select ?"},
+		{SQLiteDialect{}.Upsert("ledger",[]string{"UserId"},[]string{"UserBalance"}),
+			"INSERT INTO ledger (UserId,UserBalance) VALUES (?,?) ON CONFLICT (UserId) DO UPDATE SET UserBalance = excluded.UserBalance"},
+		{PostgresDialect{}.Upsert("ledger",[]string{"UserId"},nil),
+			"INSERT INTO ledger (UserId) VALUES (?) ON CONFLICT (UserId) DO NOTHING"},
+		{MySQLDialect{}.Upsert("ledger",[]string{"UserId"},[]string{"UserBalance"}),
+			"INSERT INTO ledger (UserId,UserBalance) VALUES (?,?) ON DUPLICATE KEY UPDATE UserBalance = VALUES(UserBalance)"},
+		{SQLiteDialect{}.AutoIncrement("Id"),"Id integer primary key autoincrement"},
+		{PostgresDialect{}.AutoIncrement("Id"),"Id serial primary key"},
+		{MySQLDialect{}.AutoIncrement("Id"),"Id integer primary key auto_increment"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("dialect : expected %v got %v",c.expected,c.got)
+		}
+	}
+}
+
+func TestDialectSQLiteRuns(t *testing.T) {
+	var dialect = SQLiteDialect{}
+	var balance = -1
+	var upsert = dialect.Upsert("ledger",[]string{"UserId"},[]string{"UserBalance"})
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalContext(context.Background(),"sqlite3",tmpfile,AndContext(
+			ExecuteSQLContext("create table ledger (" + dialect.AutoIncrement("UserId") + ", UserBalance integer)"),
+			ExecuteSQLContext(upsert,1,100),
+			ExecuteSQLContext(upsert,1,50),
+			ExecuteQueryContext("select UserBalance from ledger where UserId = ?",1)(&balance)))
+		if !result.Ok() || balance != 50 {
+			t.Errorf("dialect : expected upsert to update got %v %v",result,balance)
+		}
+	})
+}
+
+func TestEvalOpenUnknownDialect(t *testing.T) {
+	var dialect string
+	var report = EvalOpen(context.Background(),"kat_sqlite",":memory:",func(ctx context.Context,tx Executor) Result {
+		dialect = DialectOf(ctx).Name()
+		var n int
+		return QueryValue(&n,"select ?",1)(ctx,tx)
+	})
+	if report.Err != nil || !report.Result.Ok() || dialect != "sqlite3" {
+		t.Errorf("dialect : expected an unknown driver to keep the default dialect got %v %v",dialect,report)
+	}
+}
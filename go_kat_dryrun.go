@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+ dry runs. With WithDryRun EvalDB reads the tables before and after
+ the expression, always rolls back and reports the difference in
+ EvalReport.Diffs. A table that does not exist, because the expression
+ creates it for example, is taken to be empty. Any other error reading
+ a table is the result of the dry run and no diffs are reported.
+*/
+
+/* the rows a dry run would have added to and removed from a table */
+type TableDiff struct {
+	Table   string
+	Columns []string
+	Added   [][]interface{}
+	Removed [][]interface{}
+}
+
+type dryRunKey struct{}
+
+func WithDryRun(ctx context.Context, tables ...string) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, tables)
+}
+
+func dryRunTables(ctx context.Context) ([]string, bool) {
+	tables, ok := ctx.Value(dryRunKey{}).([]string)
+	return tables, ok
+}
+
+type tableSnapshot struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func readTable(ctx context.Context, tx Executor, table string) (tableSnapshot, Result) {
+	var snapshot tableSnapshot
+	var step = "Snapshot: " + table
+	rows, err := tx.Query(ctx, "SELECT * FROM "+table)
+	if err != nil {
+		return snapshot, contextFault(ctx, step, err)
+	}
+	defer rows.Close()
+	if snapshot.columns, err = rows.Columns(); err != nil {
+		return snapshot, contextFault(ctx, step, err)
+	}
+	for rows.Next() {
+		var values = make([]interface{}, len(snapshot.columns))
+		var targets = make([]interface{}, len(values))
+		for i := range values {
+			targets[i] = &values[i]
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return snapshot, contextFault(ctx, step, err)
+		}
+		for i, value := range values {
+			if bytes, ok := value.([]byte); ok {
+				values[i] = string(bytes)
+			}
+		}
+		snapshot.rows = append(snapshot.rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return snapshot, contextFault(ctx, step, err)
+	}
+	return snapshot, Passed()
+}
+
+/* undefined_table */
+var missingTableStates = []string{"42P01"}
+
+/* sqlite, postgres and mysql */
+var missingTableMessages = []string{"no such table", "does not exist", "doesn't exist"}
+
+func isMissingTable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		for _, state := range missingTableStates {
+			if stateErr.SQLState() == state {
+				return true
+			}
+		}
+	}
+	var message = strings.ToLower(err.Error())
+	for _, missing := range missingTableMessages {
+		if strings.Contains(message, missing) {
+			return true
+		}
+	}
+	return false
+}
+
+/* reads every table in its own savepoint so a missing table leaves the transaction usable */
+func snapshotTables(ctx context.Context, tx Executor, tables []string) ([]tableSnapshot, Result) {
+	var snapshots = make([]tableSnapshot, len(tables))
+	for i, table := range tables {
+		var r = inSavepoint(ctx, tx, func(ctx context.Context, tx Executor) Result {
+			var r Result
+			snapshots[i], r = readTable(ctx, tx, table)
+			return r
+		})
+		if r.Kind == Errored && isMissingTable(r.Err) {
+			snapshots[i] = tableSnapshot{}
+		} else if !r.Ok() {
+			return snapshots, r
+		}
+	}
+	return snapshots, Passed()
+}
+
+/* rows are compared as a multiset, a changed row is removed and added */
+func diffTable(table string, before tableSnapshot, after tableSnapshot) TableDiff {
+	var diff = TableDiff{Table: table, Columns: after.columns}
+	if diff.Columns == nil {
+		diff.Columns = before.columns
+	}
+	var counts = map[string]int{}
+	for _, row := range before.rows {
+		counts[fmt.Sprint(row)]++
+	}
+	for _, row := range after.rows {
+		var key = fmt.Sprint(row)
+		if counts[key] > 0 {
+			counts[key]--
+		} else {
+			diff.Added = append(diff.Added, row)
+		}
+	}
+	for _, row := range before.rows {
+		var key = fmt.Sprint(row)
+		if counts[key] > 0 {
+			counts[key]--
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+	return diff
+}
+
+func (diff TableDiff) Empty() bool { return len(diff.Added) == 0 && len(diff.Removed) == 0 }
+
+func (diff TableDiff) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%v %v\n", diff.Table, diff.Columns)
+	for _, row := range diff.Removed {
+		fmt.Fprintf(&builder, "- %v\n", row)
+	}
+	for _, row := range diff.Added {
+		fmt.Fprintf(&builder, "+ %v\n", row)
+	}
+	return builder.String()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"strings"
+	"context"
+	"fmt"
+	"database/sql"
+)
+
+func TestDryRunRollsBack(t *testing.T) {
+	var total = -1
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table d (id integer, name text)"),
+			                                  ExecuteSQLContext("insert into d (id,name) VALUES (1,'a'),(2,'b')")))
+		var ctx = WithDryRun(context.Background(),"d","created")
+		var report = EvalDB(ctx,db,AndContext(ExecuteSQLContext("update d set name = 'c' where id = 2"),
+			                               ExecuteSQLContext("insert into d (id,name) VALUES (3,'d')"),
+			                               ExecuteSQLContext("create table created (c integer)"),
+			                               ExecuteSQLContext("insert into created (c) VALUES (1)")))
+		if report.Committed || !report.Result.Ok() || len(report.Diffs) != 2 {
+			t.Fatalf("dry run : expected two diffs and no commit got %v %v",report,report.Diffs)
+		}
+		var d = report.Diffs[0]
+		if fmt.Sprint(d.Removed) != "[[2 b]]" || fmt.Sprint(d.Added) != "[[2 c] [3 d]]" {
+			t.Errorf("dry run : unexpected diff %v",d)
+		}
+		if fmt.Sprint(report.Diffs[1].Added) != "[[1]]" || len(report.Diffs[1].Removed) != 0 {
+			t.Errorf("dry run : expected a new table to be diffed against empty got %v",report.Diffs[1])
+		}
+		EvalDB(context.Background(),db,QueryValue(&total,"select count(*) from d where name = 'b'"))
+		if total != 1 {
+			t.Errorf("dry run : expected the update to be rolled back")
+		}
+	})
+}
+
+func TestDryRunFailure(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,ExecuteSQLContext("create table d (id integer)"))
+		var report = EvalDB(WithDryRun(context.Background(),"d"),db,AndContext(ExecuteSQLContext("insert into d (id) VALUES (1)"),ZeroContext))
+		if report.Result.Kind != TestFailed || len(report.Diffs) != 1 || !report.Diffs[0].Empty() {
+			t.Errorf("dry run : expected a failed expression to have no effect got %v %v",report,report.Diffs)
+		}
+	})
+}
+
+func TestDryRunUnreadableTable(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,ExecuteSQLContext("create table d (id integer)"))
+		var insert = ExecuteSQLContext("insert into d (id) VALUES (1)")
+		var report = EvalDB(WithDryRun(context.Background(),"d","missing"),db,insert)
+		if !report.Result.Ok() || len(report.Diffs) != 2 || len(report.Diffs[0].Added) != 1 || !report.Diffs[1].Empty() {
+			t.Errorf("dry run : expected a missing table to be empty got %v %v",report,report.Diffs)
+		}
+		report = EvalDB(WithDryRun(context.Background(),"d","d where"),db,insert)
+		if report.Result.Kind != Errored || !strings.HasPrefix(report.Result.Step,"Snapshot: d where") || len(report.Diffs) != 0 {
+			t.Errorf("dry run : expected the read error reported got %v %v",report,report.Diffs)
+		}
+	})
+}
+
+func TestDiffTableDuplicates(t *testing.T) {
+	var before = tableSnapshot{[]string{"a"},[][]interface{}{{1},{1},{2}}}
+	var after = tableSnapshot{[]string{"a"},[][]interface{}{{1},{2},{2}}}
+	var diff = diffTable("t",before,after)
+	if diff.String() != "t [a]\n- [1]\n+ [2]\n" {
+		t.Errorf("dry run : unexpected diff %q",diff.String())
+	}
+}
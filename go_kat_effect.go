@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+/*
+ effects of leaves. Go cannot tell a test from a command so a leaf
+ declares it : a read-only leaf only queries, a mutating leaf may
+ write. Leaves are mutating unless built with ReadOnlyLeaf. The
+ declaration is checked when debugging, a read-only leaf then runs
+ in a savepoint that is always discarded and its writes are refused.
+*/
+type Effect int
+
+const (
+	Mutating Effect = iota
+	ReadOnly
+)
+
+func (effect Effect) String() string {
+	switch effect {
+	case Mutating:
+		return "mutating"
+	case ReadOnly:
+		return "read-only"
+	}
+	return fmt.Sprintf("Effect(%d)", int(effect))
+}
+
+func ReadOnlyLeaf(name string, op KatExpression, params ...interface{}) Expr {
+	return LeafNode{name, params, LiftContext(op), ReadOnly}
+}
+
+func ReadOnlyLeafContext(name string, op KatContextExpression, params ...interface{}) Expr {
+	return LeafNode{name, params, op, ReadOnly}
+}
+
+/* an expression is read-only when all its leaves are */
+func EffectOf(e Expr) Effect {
+	if leaf, ok := e.(LeafNode); ok {
+		return leaf.Effect
+	}
+	for _, child := range Children(e) {
+		if EffectOf(child) == Mutating {
+			return Mutating
+		}
+	}
+	return ReadOnly
+}
+
+func effectsOf(args []Expr) []Effect {
+	var effects = make([]Effect, len(args))
+	for i, arg := range args {
+		effects[i] = EffectOf(arg)
+	}
+	return effects
+}
+
+/* a read-only leaf that wrote */
+type EffectError struct {
+	Leaf      string
+	Statement string
+}
+
+func (err *EffectError) Error() string {
+	return fmt.Sprintf("read-only %v wrote: %v", err.Leaf, err.Statement)
+}
+
+/* statements that cannot write, anything else is taken to be a write */
+var readStatements = []string{"SELECT", "WITH", "VALUES", "EXPLAIN"}
+
+/* keywords that make a WITH a write wherever they appear, in its queries or the statement it ends in */
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "MERGE", "REPLACE"}
+
+func isRead(statement string) bool {
+	var fields = strings.Fields(statement)
+	if len(fields) == 0 {
+		return true
+	}
+	if strings.EqualFold(fields[0], "WITH") {
+		return !writesIn(statement)
+	}
+	for _, keyword := range readStatements {
+		if strings.EqualFold(fields[0], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+/* whether a word outside the strings and comments of statement is a write keyword */
+func writesIn(statement string) bool {
+	var word = func(c byte) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(statement); {
+		if end := skipLiteral(statement, i); end > i {
+			i = end
+			continue
+		}
+		if !word(statement[i]) {
+			i++
+			continue
+		}
+		var start = i
+		for i < len(statement) && word(statement[i]) {
+			i++
+		}
+		for _, keyword := range writeKeywords {
+			if strings.EqualFold(statement[start:i], keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* refuses writes and remembers the first one, savepoints pass through */
+type readOnlyExecutor struct {
+	Executor
+	leaf  string
+	write string
+}
+
+func (tx *readOnlyExecutor) refuse(statement string) error {
+	if tx.write == "" {
+		tx.write = strings.Join(strings.Fields(statement), " ")
+	}
+	return &EffectError{tx.leaf, tx.write}
+}
+
+func (tx *readOnlyExecutor) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if !isRead(query) {
+		return nil, tx.refuse(query)
+	}
+	return tx.Executor.Exec(ctx, query, args...)
+}
+
+func (tx *readOnlyExecutor) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	if !isRead(query) {
+		return nil, tx.refuse(query)
+	}
+	return tx.Executor.Query(ctx, query, args...)
+}
+
+/* runs a read-only leaf so that a write is an error even when the leaf swallows it */
+func checkReadOnly(ctx context.Context, tx Executor, name string, op KatContextExpression) Result {
+	savepoint, r := BeginSavepoint(ctx, tx)
+	if !r.Ok() {
+		return r
+	}
+	var checked = &readOnlyExecutor{Executor: tx, leaf: name}
+	var result = op(ctx, checked)
+	if result.Kind == Cancelled {
+		/* ctx is done, the savepoint is discarded without its cancellation */
+		savepoint.Discard(context.WithoutCancel(ctx))
+		return result
+	}
+	if r := savepoint.Discard(ctx); !r.Ok() {
+		return r
+	}
+	if checked.write != "" {
+		return Faulted(name, &EffectError{name, checked.write})
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"strings"
+)
+
+func TestEffectOf(t *testing.T) {
+	var p, c = ReadOnlyLeaf("p",One), Leaf("c",One)
+	var cases = []struct {
+		e        Expr
+		expected Effect
+	}{
+		{p,ReadOnly},
+		{c,Mutating},
+		{ZeroExpr,ReadOnly},
+		{AndExpr(p,NotExpr(p),StarExpr(OneExpr)),ReadOnly},
+		{OrExpr(p,AndExpr(p,c)),Mutating},
+	}
+	for _, test := range cases {
+		if effect := EffectOf(test.e); effect != test.expected {
+			t.Errorf("effect : %v expected %v got %v",test.e,test.expected,effect)
+		}
+	}
+}
+
+func TestReadOnlyLeafWrites(t *testing.T) {
+	var writes = ReadOnlyLeafContext("writes",ExecuteSQLContext("insert into a (a) VALUES (1)"))
+	var swallows = ReadOnlyLeaf("swallows",Not(ExecuteSQL("delete from a")))
+	for _, e := range []Expr{writes,swallows} {
+		var fake = NewFakeExecutor()
+		var r = e.Compile()(WithDebug(context.Background()),fake)
+		var effectErr *EffectError
+		if r.Kind != Errored || !errors.As(r.Err,&effectErr) || effectErr.Leaf != e.String() {
+			t.Errorf("effect : %v expected an effect error got %v",e,r)
+		}
+		for _, query := range fake.Queries() {
+			if strings.HasPrefix(query,"insert") || strings.HasPrefix(query,"delete") {
+				t.Errorf("effect : %v write reached the executor %v",e,fake.Queries())
+			}
+		}
+	}
+	if r := writes.Compile()(context.Background(),NewFakeExecutor()); !r.Ok() {
+		t.Errorf("effect : unchecked without debugging got %v",r)
+	}
+}
+
+func TestReadOnlyLeafReads(t *testing.T) {
+	var fake = NewFakeExecutor().Answer("select 1",[]interface{}{1})
+	var reads = ReadOnlyLeafContext("reads",ExecuteQueryContext("select 1")(new(int)))
+	if r := reads.Compile()(WithDebug(context.Background()),fake); !r.Ok() {
+		t.Errorf("effect : read expected success got %v",r)
+	}
+	var queries = fake.Queries()
+	if len(queries) != 4 || !strings.HasPrefix(queries[0],"savepoint") || !strings.HasPrefix(queries[2],"rollback to savepoint") {
+		t.Errorf("effect : expected the read in a discarded savepoint got %v",queries)
+	}
+}
+
+func TestIsRead(t *testing.T) {
+	var cases = []struct {
+		statement string
+		expected  bool
+	}{
+		{"select * from a",true},
+		{"  VALUES (1)",true},
+		{"with b as (select a from a) select * from b",true},
+		{"with b as (select 'delete' from a) select * from b -- update",true},
+		{"with updated_at as (select 1) select * from updated_at",true},
+		{"with b as (select a from a) delete from a where a in (select a from b)",false},
+		{"WITH b AS (SELECT a FROM a) INSERT INTO c SELECT * FROM b",false},
+		{"with d as (delete from a returning a) select * from d",false},
+		{"insert into a (a) VALUES (1)",false},
+	}
+	for _, test := range cases {
+		if read := isRead(test.statement); read != test.expected {
+			t.Errorf("effect : isRead %q expected %v got %v",test.statement,test.expected,read)
+		}
+	}
+}
+
+func TestReadOnlyLeafCancelled(t *testing.T) {
+	var fake = NewFakeExecutor()
+	ctx, cancel := context.WithCancel(WithDebug(context.Background()))
+	defer cancel()
+	var cancels = ReadOnlyLeafContext("cancels",func(ctx context.Context,tx Executor) Result {
+		cancel()
+		return Interrupted("cancels",ctx.Err())
+	})
+	if r := cancels.Compile()(ctx,fake); r.Kind != Cancelled {
+		t.Errorf("effect : expected cancelled got %v",r)
+	}
+	var queries = fake.Queries()
+	if len(queries) != 3 || !strings.HasPrefix(queries[1],"rollback to savepoint") || !strings.HasPrefix(queries[2],"release savepoint") {
+		t.Errorf("effect : expected the savepoint discarded after cancellation got %v",queries)
+	}
+}
+
+func TestOrReadOnlyBranches(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var r = OrExpr(ReadOnlyLeaf("q",Zero),ReadOnlyLeaf("p",One)).Compile()(context.Background(),fake)
+	if !r.Ok() || len(fake.Queries()) != 0 {
+		t.Errorf("effect : read-only or expected no savepoint got %v %v",r,fake.Queries())
+	}
+	fake = NewFakeExecutor()
+	r = OrExpr(ReadOnlyLeaf("q",Zero),LeafContext("c",ExecuteSQLContext("insert into a (a) VALUES (1)"))).Compile()(context.Background(),fake)
+	var queries = fake.Queries()
+	if !r.Ok() || len(queries) != 3 || !strings.HasPrefix(queries[0],"savepoint") || !strings.HasPrefix(queries[2],"release savepoint") {
+		t.Errorf("effect : expected no rollback after a read-only branch got %v %v",r,queries)
+	}
+}
+
+func TestOrReadOnlyError(t *testing.T) {
+	var failing = ReadOnlyLeafContext("failing",ExecuteQueryContext("select 1")(new(int)))
+	var writes = LeafContext("writes",ExecuteSQLContext("insert into a (a) VALUES (1)"))
+	var cases = []struct {
+		e        Expr
+		expected []string
+		kind     ResultKind
+	}{
+		{OrExpr(failing,ReadOnlyLeaf("p",One)),[]string{"select 1"},Errored},
+		{OrExpr(failing,writes),[]string{"select 1"},Errored},
+		{OrExpr(LeafContext("c",ExecuteSQLContext("update a set a = 2")),failing),
+		 []string{"savepoint","update","rollback to savepoint","select 1","rollback to savepoint","release savepoint"},Errored},
+		{OrExpr(LeafContext("c",ExecuteSQLContext("update a set a = 2")),ReadOnlyLeaf("q",Zero),failing,writes),
+		 []string{"savepoint","update","rollback to savepoint","select 1","rollback to savepoint","insert","release savepoint"},Success},
+	}
+	for _, test := range cases {
+		var fake = NewFakeExecutor().Fail("select 1",errors.New("locked")).Fail("update a set a = 2",errors.New("locked"))
+		if r := test.e.Compile()(context.Background(),fake); r.Kind != test.kind {
+			t.Errorf("effect : %v expected %v got %v",test.e,test.kind,r)
+		}
+		var queries = fake.Queries()
+		if len(queries) != len(test.expected) {
+			t.Errorf("effect : %v expected %v got %v",test.e,test.expected,queries)
+			continue
+		}
+		for i, prefix := range test.expected {
+			if !strings.HasPrefix(queries[i],prefix) {
+				t.Errorf("effect : %v expected %v got %v",test.e,test.expected,queries)
+				break
+			}
+		}
+	}
+}
+
+func TestProcessEntryDebugging(t *testing.T) {
+	WithTestFile(t,func(tmpfile string){
+		var entry = Entry{1, 2, 10}
+		var e = AndExpr(Leaf("setup",And(CreateSchema,SaveBatch([]Entry{entry}))),ProcessEntryExpr(1,entry))
+		var report = EvalOpen(WithDebug(context.Background()),"sqlite3",tmpfile,e.Compile())
+		if report.Err != nil || !report.Result.Ok() {
+			t.Errorf("effect : process entry expected success while debugging got %v",report)
+		}
+	})
+}
+
+func TestParseReadOnly(t *testing.T) {
+	e, err := LedgerAtoms.Parse("batchExists(1) * deleteBatch(1)")
+	if err != nil {
+		t.Fatalf("parse : %v",err)
+	}
+	var args = Children(e)
+	if EffectOf(args[0]) != ReadOnly || EffectOf(args[1]) != Mutating {
+		t.Errorf("parse : expected read-only batchExists and mutating deleteBatch got %v %v",EffectOf(args[0]),EffectOf(args[1]))
+	}
+}
+
+func TestOrLazySavepoint(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var r = OrExpr(ReadOnlyLeaf("p",One),LeafContext("c",ExecuteSQLContext("insert into a (a) VALUES (1)"))).Compile()(context.Background(),fake)
+	if !r.Ok() || len(fake.Queries()) != 0 {
+		t.Errorf("effect : expected no savepoint when the test decides got %v %v",r,fake.Queries())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ decision procedure for the test fragment : every leaf is read-only
+ and read as a side effect free test, so an expression denotes a
+ function from the truth values of its atoms to an outcome. Star
+ follows the implementation : p⃰ stops when p fails and never returns
+ when p holds.
+*/
+type TestValue int
+
+const (
+	TestFalse TestValue = iota
+	TestTrue
+	Diverges
+)
+
+func (value TestValue) String() string {
+	switch value {
+	case TestFalse:
+		return "0"
+	case TestTrue:
+		return "1"
+	}
+	return "diverges"
+}
+
+/* truth values of the atoms, keyed by the printed leaf e.g. senderExists(1) */
+type Assignment map[string]bool
+
+func (assignment Assignment) String() string {
+	var parts []string
+	for _, atom := range sortedAtoms(assignment) {
+		parts = append(parts, fmt.Sprintf("%v=%v", atom, TestValue(boolValue(assignment[atom]))))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+type Counterexample struct {
+	Assignment Assignment
+	Left       TestValue
+	Right      TestValue
+}
+
+func (c Counterexample) String() string {
+	return fmt.Sprintf("%v : %v != %v", c.Assignment, c.Left, c.Right)
+}
+
+/* the number of assignments checked is 2^MaxAtoms */
+const MaxAtoms = 20
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedAtoms(assignment Assignment) []string {
+	var atoms []string
+	for atom := range assignment {
+		atoms = append(atoms, atom)
+	}
+	sort.Strings(atoms)
+	return atoms
+}
+
+func Atoms(e Expr) []string {
+	var seen = map[string]bool{}
+	var atoms []string
+	Walk(e, func(node Expr) bool {
+		if leaf, ok := node.(LeafNode); ok && !seen[leaf.String()] {
+			seen[leaf.String()] = true
+			atoms = append(atoms, leaf.String())
+		}
+		return true
+	})
+	sort.Strings(atoms)
+	return atoms
+}
+
+func EvalTest(e Expr, assignment Assignment) TestValue {
+	switch node := e.(type) {
+	case ZeroNode:
+		return TestFalse
+	case OneNode:
+		return TestTrue
+	case LeafNode:
+		return TestValue(boolValue(assignment[node.String()]))
+	case NotNode:
+		switch value := EvalTest(node.Arg, assignment); value {
+		case TestFalse:
+			return TestTrue
+		case TestTrue:
+			return TestFalse
+		default:
+			return value
+		}
+	case AndNode:
+		for _, arg := range node.Args {
+			if value := EvalTest(arg, assignment); value != TestTrue {
+				return value
+			}
+		}
+		return TestTrue
+	case OrNode:
+		var value = TestTrue
+		for _, arg := range node.Args {
+			if value = EvalTest(arg, assignment); value != TestFalse {
+				return value
+			}
+		}
+		return value
+	case StarNode:
+		switch value := EvalTest(node.Arg, assignment); value {
+		case TestFalse:
+			return TestTrue
+		default:
+			return Diverges
+		}
+	}
+	panic(fmt.Sprintf("EvalTest: unknown expression %T", e))
+}
+
+/* the first node of e outside the test fragment, an expression of another package or a leaf that may write */
+func testFragment(e Expr) error {
+	var err error
+	Walk(e, func(node Expr) bool {
+		if err != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case ZeroNode, OneNode, NotNode, AndNode, OrNode, StarNode:
+		case LeafNode:
+			if node.Effect != ReadOnly {
+				err = fmt.Errorf("Equivalent: %v is %v, only read-only leaves are tests", node, node.Effect)
+			}
+		default:
+			err = fmt.Errorf("Equivalent: unknown expression %T", node)
+		}
+		return err == nil
+	})
+	return err
+}
+
+/*
+ returns nil when a and b agree on every assignment of their atoms.
+ Only read-only leaves are compared, an expression with a mutating
+ leaf or a node of another package is an error.
+*/
+func Equivalent(a Expr, b Expr) (*Counterexample, error) {
+	for _, e := range []Expr{a, b} {
+		if err := testFragment(e); err != nil {
+			return nil, err
+		}
+	}
+	var seen = map[string]bool{}
+	var atoms []string
+	for _, atom := range append(Atoms(a), Atoms(b)...) {
+		if !seen[atom] {
+			seen[atom] = true
+			atoms = append(atoms, atom)
+		}
+	}
+	sort.Strings(atoms)
+	if len(atoms) > MaxAtoms {
+		return nil, fmt.Errorf("Equivalent: %d atoms exceeds %d", len(atoms), MaxAtoms)
+	}
+	for bits := 0; bits < 1<<len(atoms); bits++ {
+		var assignment = Assignment{}
+		for i, atom := range atoms {
+			assignment[atom] = bits&(1<<i) != 0
+		}
+		var left, right = EvalTest(a, assignment), EvalTest(b, assignment)
+		if left != right {
+			return &Counterexample{assignment, left, right}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"math/rand"
+)
+
+func randomTestExpr(random *rand.Rand,depth int) Expr {
+	var atoms = []Expr{ReadOnlyLeaf("p",One),ReadOnlyLeaf("q",One),ReadOnlyLeaf("r",One,1)}
+	if depth == 0 {
+		switch random.Intn(5) {
+		case 0:
+			return ZeroExpr
+		case 1:
+			return OneExpr
+		}
+		return atoms[random.Intn(len(atoms))]
+	}
+	var args = func() []Expr {
+		var result []Expr
+		for i := random.Intn(4); i > 0; i-- {
+			result = append(result,randomTestExpr(random,depth-1))
+		}
+		return result
+	}
+	switch random.Intn(5) {
+	case 0:
+		return AndExpr(args()...)
+	case 1:
+		return OrExpr(args()...)
+	case 2:
+		return NotExpr(randomTestExpr(random,depth-1))
+	case 3:
+		return StarExpr(randomTestExpr(random,depth-1))
+	}
+	return randomTestExpr(random,0)
+}
+
+func TestEquivalentLaws(t *testing.T) {
+	var p = ReadOnlyLeaf("p",One)
+	var q = ReadOnlyLeaf("q",One)
+	var r = ReadOnlyLeaf("r",One)
+	var laws = [][2]Expr{
+		{OrExpr(ZeroExpr,p),p},
+		{OrExpr(p,p),p},
+		{AndExpr(OneExpr,p),p},
+		{AndExpr(ZeroExpr,p),ZeroExpr},
+		{AndExpr(p,OrExpr(q,r)),OrExpr(AndExpr(p,q),AndExpr(p,r))},
+		{AndExpr(p,q),AndExpr(q,p)},
+		{NotExpr(AndExpr(p,q)),OrExpr(NotExpr(p),NotExpr(q))},
+		{OrExpr(AndExpr(p,StarExpr(p)),OneExpr),StarExpr(p)},
+	}
+	for _, law := range laws {
+		counterexample, err := Equivalent(law[0],law[1])
+		if err != nil || counterexample != nil {
+			t.Errorf("equivalent : expected %v = %v got %v %v",law[0],law[1],counterexample,err)
+		}
+	}
+}
+
+func TestEquivalentCounterexample(t *testing.T) {
+	var p = ReadOnlyLeaf("p",One)
+	var q = ReadOnlyLeaf("q",One)
+	counterexample, err := Equivalent(OrExpr(p,q),p)
+	if err != nil || counterexample == nil {
+		t.Fatalf("equivalent : expected counterexample got %v",err)
+	}
+	if counterexample.Assignment["p"] || !counterexample.Assignment["q"] {
+		t.Errorf("equivalent : expected p=0 q=1 got %v",counterexample)
+	}
+	if counterexample.Left != TestTrue || counterexample.Right != TestFalse {
+		t.Errorf("equivalent : expected 1 != 0 got %v",counterexample)
+	}
+	counterexample, _ = Equivalent(StarExpr(p),OneExpr)
+	if counterexample == nil || counterexample.Left != Diverges {
+		t.Errorf("equivalent : expected star of a true test to diverge got %v",counterexample)
+	}
+}
+
+func TestEquivalentTooManyAtoms(t *testing.T) {
+	var args []Expr
+	for i := 0; i <= MaxAtoms; i++ {
+		args = append(args,ReadOnlyLeaf("p",One,i))
+	}
+	if _, err := Equivalent(AndExpr(args...),OneExpr); err == nil {
+		t.Errorf("equivalent : expected too many atoms")
+	}
+}
+
+type foreignExpr struct{ OneNode }
+
+func TestEquivalentOutsideFragment(t *testing.T) {
+	var p = ReadOnlyLeaf("p",One)
+	for _, e := range []Expr{AndExpr(p,Leaf("c",One)),OrExpr(p,NotExpr(foreignExpr{}))} {
+		if _, err := Equivalent(e,p); err == nil {
+			t.Errorf("equivalent : %v expected an error",e)
+		}
+		if _, err := Equivalent(p,e); err == nil {
+			t.Errorf("equivalent : %v expected an error",e)
+		}
+	}
+}
+
+func TestSimplifyIsSound(t *testing.T) {
+	var random = rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var e = randomTestExpr(random,4)
+		for _, options := range []SimplifyOptions{{},{Distribute: true}} {
+			var after, _ = Simplify(e,options)
+			if counterexample, err := Equivalent(e,after); err != nil || counterexample != nil {
+				t.Errorf("simplify %v => %v : %v %v",e,after,counterexample,err)
+			}
+		}
+	}
+}
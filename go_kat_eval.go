@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/* a leaf evaluation recorded while running an expression */
+type TraceStep struct {
+	Name    string
+	Args    []interface{}
+	Result  Result
+	Elapsed time.Duration
+}
+
+/* what an evaluation did : Err is the open, begin, commit or rollback error */
+type EvalReport struct {
+	Committed  bool
+	Result     Result
+	Err        error
+	Attempts   int
+	Elapsed    time.Duration
+	Steps      []TraceStep
+	Rows       []RowOutcome
+	Violations []ContractViolation
+	Diffs      []TableDiff
+}
+
+type stepsKey struct{}
+
+type stepRecorder struct {
+	lock       sync.Mutex
+	steps      []TraceStep
+	rows       []RowOutcome
+	violations []ContractViolation
+}
+
+func traceStep(ctx context.Context, name string, args []interface{}, op func() Result) Result {
+	var start = time.Now()
+	_, node := enterTrace(ctx, name, args)
+	var result = exitTrace(node, start, observed(ctx, StatementSpan, name, op))
+	logStep(ctx, name, args, result, time.Since(start))
+	if recorder, ok := ctx.Value(stepsKey{}).(*stepRecorder); ok {
+		recorder.lock.Lock()
+		recorder.steps = append(recorder.steps, TraceStep{name, args, result, time.Since(start)})
+		recorder.lock.Unlock()
+	}
+	return result
+}
+
+func (report *EvalReport) fail(ctx context.Context, phase string, err error) {
+	report.Err = fmt.Errorf("%s: %w", phase, err)
+	report.Result = contextFault(ctx, phase, err)
+}
+
+/* retried as a whole when ctx carries a retry policy, the report is the last attempt's */
+func EvalDB(ctx context.Context, db *sql.DB, expression KatContextExpression) EvalReport {
+	var start = time.Now()
+	policy, retry := ctx.Value(retryKey{}).(RetryPolicy)
+	var report EvalReport
+	for attempt := 1; ; attempt++ {
+		report = evalOnce(ctx, db, expression)
+		report.Attempts = attempt
+		if !retry || report.Committed || !policy.retries(attempt, report.transientErr()) {
+			break
+		}
+		if err := policy.wait(ctx, attempt); err != nil {
+			report.fail(ctx, "Retry", err)
+			break
+		}
+	}
+	report.Elapsed = time.Since(start)
+	return report
+}
+
+func evalOnce(ctx context.Context, db *sql.DB, expression KatContextExpression) EvalReport {
+	var recorder = &stepRecorder{}
+	var report EvalReport
+	ctx = context.WithValue(ctx, stepsKey{}, recorder)
+	if tx, err := db.BeginTx(ctx, nil); err != nil {
+		report.fail(ctx, "Begin", err)
+	} else if tables, ok := dryRunTables(ctx); ok {
+		report.dryRun(ctx, tx, tables, expression)
+	} else {
+		report.Result = expression(ctx, NewTxExecutor(tx, DialectOf(ctx)))
+		if report.Result.Ok() {
+			if err := tx.Commit(); err != nil {
+				report.fail(ctx, "Commit", err)
+			} else {
+				report.Committed = true
+			}
+		} else if err := tx.Rollback(); err != nil && report.Result.Kind != Cancelled {
+			report.fail(ctx, "Rollback", err)
+		}
+	}
+	report.Steps = recorder.steps
+	report.Rows = recorder.rows
+	report.Violations = recorder.violations
+	return report
+}
+
+/* runs expression between two snapshots of tables and rolls back */
+func (report *EvalReport) dryRun(ctx context.Context, tx *sql.Tx, tables []string, expression KatContextExpression) {
+	report.Result = report.diff(ctx, NewTxExecutor(tx, DialectOf(ctx)), tables, expression)
+	if err := tx.Rollback(); err != nil && report.Result.Kind != Cancelled {
+		report.fail(ctx, "Rollback", err)
+	}
+}
+
+/* runs expression between two snapshots, there are no diffs when a table could not be read */
+func (report *EvalReport) diff(ctx context.Context, executor Executor, tables []string, expression KatContextExpression) Result {
+	before, r := snapshotTables(ctx, executor, tables)
+	if !r.Ok() {
+		return r
+	}
+	var result = expression(ctx, executor)
+	if result.Kind == Cancelled {
+		return result
+	}
+	/* a failed expression would have been rolled back so it changes nothing */
+	var after = before
+	if result.Ok() {
+		if after, r = snapshotTables(ctx, executor, tables); !r.Ok() {
+			return r
+		}
+	}
+	for i, table := range tables {
+		report.Diffs = append(report.Diffs, diffTable(table, before[i], after[i]))
+	}
+	return result
+}
+
+/* the error that stopped the attempt */
+func (report EvalReport) transientErr() error {
+	if report.Err != nil {
+		return report.Err
+	} else if report.Result.Kind == Errored {
+		return report.Result.Err
+	}
+	return nil
+}
+
+/*
+ the dialect is chosen from driverName unless ctx already carries one.
+ A driver DialectFor does not know keeps the default of DialectOf, its
+ statements are run with their ? placeholders as written.
+*/
+func EvalOpen(ctx context.Context, driverName string, dataSourceName string, expression KatContextExpression) EvalReport {
+	if _, ok := ctx.Value(dialectKey{}).(Dialect); !ok {
+		if dialect, err := DialectFor(driverName); err == nil {
+			ctx = WithDialect(ctx, dialect)
+		}
+	}
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		var report EvalReport
+		report.fail(ctx, "Open", err)
+		return report
+	}
+	defer db.Close()
+	return EvalDB(ctx, db, expression)
+}
+
+func (report EvalReport) String() string {
+	return fmt.Sprintf("committed: %v result: %v attempts: %v elapsed: %v steps: %v",
+		report.Committed,
+		report.Result,
+		report.Attempts,
+		report.Elapsed,
+		len(report.Steps))
+}
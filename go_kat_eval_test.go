@@ -0,0 +1,81 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"strings"
+	"database/sql"
+)
+
+func WithTestDB(t *testing.T,test func(*sql.DB)){
+	WithTestFile(t,func(tmpfile string){
+		db, err := sql.Open("sqlite3",tmpfile)
+		if err != nil {
+			t.Fatalf("could not open %v",tmpfile)
+		}
+		defer db.Close()
+		test(db)
+	})
+}
+
+func TestEvalDBCommits(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,ExecuteSQLContext("create table a (a integer)"))
+		if !report.Committed || report.Err != nil || !report.Result.Ok() {
+			t.Errorf("eval db : expected commit got %v",report)
+		}
+		if len(report.Steps) != 1 || !strings.HasPrefix(report.Steps[0].Name,"ExecuteSQL") {
+			t.Errorf("eval db : expected one step got %v",report.Steps)
+		}
+		if report.Elapsed <= 0 {
+			t.Errorf("eval db : expected elapsed time")
+		}
+		report = EvalDB(context.Background(),db,ExecuteSQLContext("insert into a (a) VALUES (1)"))
+		if !report.Committed {
+			t.Errorf("eval db : expected reuse of db got %v",report)
+		}
+	})
+}
+
+func TestEvalDBRollsBack(t *testing.T) {
+	var total = -1
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,ExecuteSQLContext("create table a (a integer)"))
+		var report = EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("insert into a (a) VALUES (1)"),ZeroContext))
+		if report.Committed || report.Err != nil || report.Result.Kind != TestFailed {
+			t.Errorf("eval db : expected rollback got %v",report)
+		}
+		report = EvalDB(context.Background(),db,ExecuteQueryContext("select count(*) from a")(&total))
+		if total != 0 {
+			t.Errorf("eval db : expected no rows got %v",total)
+		}
+	})
+}
+
+func TestEvalDBSteps(t *testing.T) {
+	var insertOne = ExecuteSQLContext("insert into b (b) VALUES (1)")
+	var insertTwo = ExecuteSQLContext("insert into b (b) VALUES (2)")
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table b (b integer)"),
+			                                               OrContext(AndContext(insertOne,ZeroContext),insertTwo)))
+		var names []string
+		for _, step := range report.Steps {
+			names = append(names,strings.Fields(step.Name)[0])
+		}
+		var expected = "ExecuteSQL savepoint ExecuteSQL rollback ExecuteSQL release"
+		if strings.Join(names," ") != expected {
+			t.Errorf("eval db : expected steps %v got %v",expected,names)
+		}
+	})
+}
+
+func TestEvalDBBeginError(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		db.Close()
+		var report = EvalDB(context.Background(),db,OneContext)
+		if report.Committed || report.Err == nil || report.Result.Kind != Errored || report.Result.Step != "Begin" {
+			t.Errorf("eval db : expected begin error got %v",report)
+		}
+	})
+}
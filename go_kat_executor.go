@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/* the rows of a query, *sql.Rows satisfies it */
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+/* what expressions run against : a transaction or a fake */
+type Executor interface {
+	Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	Savepoint(ctx context.Context, name string) error
+	RollbackTo(ctx context.Context, name string) error
+	Release(ctx context.Context, name string) error
+}
+
+/* runs statements on a transaction, rewriting them for the dialect */
+type TxExecutor struct {
+	Tx      *sql.Tx
+	Dialect Dialect
+}
+
+func NewTxExecutor(tx *sql.Tx, dialect Dialect) *TxExecutor {
+	return &TxExecutor{tx, dialect}
+}
+
+func (executor *TxExecutor) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return executor.Tx.ExecContext(ctx, executor.Dialect.Rebind(query), args...)
+}
+
+func (executor *TxExecutor) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	rows, err := executor.Tx.QueryContext(ctx, executor.Dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (executor *TxExecutor) Savepoint(ctx context.Context, name string) error {
+	_, err := executor.Tx.ExecContext(ctx, executor.Dialect.Savepoint(name))
+	return err
+}
+
+func (executor *TxExecutor) RollbackTo(ctx context.Context, name string) error {
+	_, err := executor.Tx.ExecContext(ctx, executor.Dialect.RollbackTo(name))
+	return err
+}
+
+func (executor *TxExecutor) Release(ctx context.Context, name string) error {
+	_, err := executor.Tx.ExecContext(ctx, executor.Dialect.Release(name))
+	return err
+}
+
+/* a statement seen by a FakeExecutor */
+type FakeStatement struct {
+	Query string
+	Args  []interface{}
+}
+
+func (statement FakeStatement) String() string {
+	if len(statement.Args) == 0 {
+		return statement.Query
+	}
+	return fmt.Sprintf("%v %v", statement.Query, statement.Args)
+}
+
+/*
+ records statements instead of running them. Queries answer with the
+ rows registered for their text and any statement can be made to fail,
+ savepoints are recorded as savepoint, rollback to savepoint and
+ release savepoint statements.
+*/
+type FakeExecutor struct {
+	lock       sync.Mutex
+	Statements []FakeStatement
+	Results    map[string][][]interface{}
+	Columns    map[string][]string
+	Errors     map[string]error
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{Results: map[string][][]interface{}{}, Columns: map[string][]string{}, Errors: map[string]error{}}
+}
+
+/* normalises white space so multi line statements can be matched */
+func fakeKey(query string) string { return strings.Join(strings.Fields(query), " ") }
+
+func (fake *FakeExecutor) Answer(query string, rows ...[]interface{}) *FakeExecutor {
+	fake.Results[fakeKey(query)] = rows
+	return fake
+}
+
+/* like Answer but the rows also report their column names */
+func (fake *FakeExecutor) AnswerColumns(query string, columns []string, rows ...[]interface{}) *FakeExecutor {
+	fake.Columns[fakeKey(query)] = columns
+	return fake.Answer(query, rows...)
+}
+
+func (fake *FakeExecutor) Fail(query string, err error) *FakeExecutor {
+	fake.Errors[fakeKey(query)] = err
+	return fake
+}
+
+func (fake *FakeExecutor) record(query string, args []interface{}) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.Statements = append(fake.Statements, FakeStatement{fakeKey(query), args})
+	return fake.Errors[fakeKey(query)]
+}
+
+/* the recorded statements without arguments */
+func (fake *FakeExecutor) Queries() []string {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	var queries = make([]string, len(fake.Statements))
+	for i, statement := range fake.Statements {
+		queries[i] = statement.Query
+	}
+	return queries
+}
+
+func (fake *FakeExecutor) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := fake.record(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), ctx.Err()
+}
+
+func (fake *FakeExecutor) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	if err := fake.record(query, args); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: fake.Columns[fakeKey(query)], rows: fake.Results[fakeKey(query)], next: -1}, nil
+}
+
+func (fake *FakeExecutor) Savepoint(ctx context.Context, name string) error {
+	return fake.record("savepoint "+name, nil)
+}
+
+func (fake *FakeExecutor) RollbackTo(ctx context.Context, name string) error {
+	return fake.record("rollback to savepoint "+name, nil)
+}
+
+func (fake *FakeExecutor) Release(ctx context.Context, name string) error {
+	return fake.record("release savepoint "+name, nil)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]interface{}
+	next    int
+}
+
+func (rows *fakeRows) Columns() ([]string, error) { return rows.columns, nil }
+
+func (rows *fakeRows) Next() bool {
+	rows.next++
+	return rows.next < len(rows.rows)
+}
+
+func (rows *fakeRows) Scan(dest ...interface{}) error {
+	var row = rows.rows[rows.next]
+	if len(row) != len(dest) {
+		return fmt.Errorf("fake: expected %d destinations got %d", len(row), len(dest))
+	}
+	for i, value := range row {
+		var target = reflect.ValueOf(dest[i])
+		if target.Kind() != reflect.Ptr || target.IsNil() {
+			return fmt.Errorf("fake: destination %d is not a pointer", i)
+		}
+		var source = reflect.ValueOf(value)
+		if !source.IsValid() {
+			target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		} else if source.Type().ConvertibleTo(target.Elem().Type()) {
+			target.Elem().Set(source.Convert(target.Elem().Type()))
+		} else {
+			return fmt.Errorf("fake: cannot scan %T into %v", value, target.Elem().Type())
+		}
+	}
+	return nil
+}
+
+func (rows *fakeRows) Err() error { return nil }
+
+func (rows *fakeRows) Close() error { return nil }
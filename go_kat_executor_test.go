@@ -0,0 +1,77 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"strings"
+)
+
+func TestFakeExecutorRecords(t *testing.T) {
+	var fake = NewFakeExecutor()
+	if !ExecuteSQL("insert into a (a) VALUES (?)",1)(fake) {
+		t.Errorf("fake : expected exec to succeed")
+	}
+	if len(fake.Statements) != 1 || fake.Statements[0].String() != "insert into a (a) VALUES (?) [1]" {
+		t.Errorf("fake : unexpected statements %v",fake.Statements)
+	}
+}
+
+func TestFakeExecutorAnswers(t *testing.T) {
+	var fake = NewFakeExecutor().Answer("select a, b from a",[]interface{}{1,"x"},[]interface{}{2,"y"})
+	var a, b, sum, text = 0, "", 0, ""
+	if !HandleQuery("select a, b\n    from a")(fake,func(){ sum += a; text += b },&a,&b) {
+		t.Fatalf("fake : expected query to succeed")
+	}
+	if sum != 3 || text != "xy" {
+		t.Errorf("fake : expected rows 1 x and 2 y got %v %v",sum,text)
+	}
+	if ExecuteQuery("select c from c")(&a)(fake) {
+		t.Errorf("fake : expected no rows for unknown query")
+	}
+}
+
+func TestFakeExecutorFails(t *testing.T) {
+	var fake = NewFakeExecutor().Fail("insert into a (a) VALUES (1)",errors.New("locked"))
+	var result = ExecuteSQLContext("insert into a (a) VALUES (1)")(context.Background(),fake)
+	if result.Kind != Errored || result.Err.Error() != "locked" {
+		t.Errorf("fake : expected injected error got %v",result)
+	}
+}
+
+func TestFakeExecutorSavepoints(t *testing.T) {
+	var fake = NewFakeExecutor()
+	if !Or(Zero,One)(fake) {
+		t.Errorf("fake : expected or to succeed")
+	}
+	var queries = fake.Queries()
+	if len(queries) != 3 ||
+		!strings.HasPrefix(queries[0],"savepoint kat_") ||
+		!strings.HasPrefix(queries[1],"rollback to savepoint kat_") ||
+		!strings.HasPrefix(queries[2],"release savepoint kat_") {
+		t.Errorf("fake : unexpected savepoints %v",queries)
+	}
+}
+
+func TestLedgerRulesWithoutDatabase(t *testing.T) {
+	var entry = Entry{1, 2, 10}
+	var exists = "SELECT count(*) > 0 FROM ledger WHERE UserId=?"
+	var fake = NewFakeExecutor().Answer(exists,[]interface{}{false})
+	if !EnsureSender(entry)(fake) {
+		t.Fatalf("ledger : expected sender to be created")
+	}
+	var created = false
+	for _, statement := range fake.Statements {
+		if strings.HasPrefix(statement.Query,"INSERT INTO ledger") && statement.Args[0] == 1 {
+			created = true
+		}
+	}
+	if !created {
+		t.Errorf("ledger : expected insert of sender 1 in %v",fake.Statements)
+	}
+	fake = NewFakeExecutor().Answer(exists,[]interface{}{true})
+	if !VerifyTransaction(entry)(fake) || VerifyTransaction(Entry{1, 2, -5})(fake) {
+		t.Errorf("ledger : expected verification to follow the amount")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/* reified expression : a tree that can be walked, printed and compared as well as evaluated */
+type Expr interface {
+	Compile() KatContextExpression
+	String() string
+}
+
+type ZeroNode struct{}
+
+type OneNode struct{}
+
+type AndNode struct{ Args []Expr }
+
+type OrNode struct{ Args []Expr }
+
+type NotNode struct{ Arg Expr }
+
+type StarNode struct{ Arg Expr }
+
+/* a named test or command, Params are only used for printing and comparison */
+type LeafNode struct {
+	Name   string
+	Params []interface{}
+	Op     KatContextExpression
+	Effect Effect
+}
+
+var ZeroExpr Expr = ZeroNode{}
+
+var OneExpr Expr = OneNode{}
+
+func AndExpr(args ... Expr) Expr { return AndNode{args} }
+
+func OrExpr(args ... Expr) Expr { return OrNode{args} }
+
+func NotExpr(arg Expr) Expr { return NotNode{arg} }
+
+func StarExpr(arg Expr) Expr { return StarNode{arg} }
+
+func Leaf(name string, op KatExpression, params ...interface{}) Expr {
+	return LeafNode{name, params, LiftContext(op), Mutating}
+}
+
+func LeafContext(name string, op KatContextExpression, params ...interface{}) Expr {
+	return LeafNode{name, params, op, Mutating}
+}
+
+func compileAll(args []Expr) []KatContextExpression {
+	var result = make([]KatContextExpression, len(args))
+	for i, arg := range args {
+		result[i] = arg.Compile()
+	}
+	return result
+}
+
+func (ZeroNode) Compile() KatContextExpression { return ZeroContext }
+
+func (OneNode) Compile() KatContextExpression { return OneContext }
+
+func (node AndNode) Compile() KatContextExpression { return AndContext(compileAll(node.Args)...) }
+
+func (node OrNode) Compile() KatContextExpression {
+	return choice(compileAll(node.Args), effectsOf(node.Args))
+}
+
+func (node NotNode) Compile() KatContextExpression { return NotContext(node.Arg.Compile()) }
+
+/* the read-only prefix of the body guards every iteration without a savepoint */
+func (node StarNode) Compile() KatContextExpression {
+	var args = []Expr{node.Arg}
+	if and, ok := node.Arg.(AndNode); ok && len(and.Args) > 0 {
+		args = and.Args
+	}
+	var prefix = 0
+	for prefix < len(args) && EffectOf(args[prefix]) == ReadOnly {
+		prefix++
+	}
+	if prefix == 0 {
+		return StarContext(node.Arg.Compile())
+	}
+	return starLoop("Star", sequence(args[:prefix]), sequence(args[prefix:]), unbounded, nil)
+}
+
+func sequence(args []Expr) KatContextExpression {
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0].Compile()
+	}
+	return AndContext(compileAll(args)...)
+}
+
+func (node LeafNode) Compile() KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var start = time.Now()
+		ctx, trace := enterTrace(ctx, node.Name, node.Params)
+		var result = observed(ctx, LeafSpan, node.Name, func() Result {
+			if node.Effect == ReadOnly && Debugging(ctx) {
+				return checkReadOnly(ctx, tx, node.String(), node.Op)
+			}
+			return node.Op(ctx, tx)
+		})
+		if result.Kind == TestFailed && result.Step == "KatExpression" {
+			result.Step = node.String()
+		}
+		return exitTrace(trace, start, result)
+	}
+}
+
+func CompileBool(e Expr) KatExpression { return LowerContext(e.Compile()) }
+
+/* printing follows the README : * for sequence, + for choice, ! for not, ⃰ for star */
+const StarSymbol = "⃰"
+
+func precedence(e Expr) int {
+	switch node := e.(type) {
+	case OrNode:
+		if len(node.Args) == 1 {
+			return precedence(node.Args[0])
+		} else if len(node.Args) > 1 {
+			return 1
+		}
+	case AndNode:
+		if len(node.Args) == 1 {
+			return precedence(node.Args[0])
+		} else if len(node.Args) > 1 {
+			return 2
+		}
+	case NotNode:
+		return 3
+	}
+	return 4
+}
+
+func operand(e Expr, parent int) string {
+	if precedence(e) < parent {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func join(args []Expr, separator string, parent int, empty string) string {
+	if len(args) == 0 {
+		return empty
+	} else if len(args) == 1 {
+		return args[0].String()
+	}
+	var parts = make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = operand(arg, parent+1)
+	}
+	return strings.Join(parts, separator)
+}
+
+func (ZeroNode) String() string { return "0" }
+
+func (OneNode) String() string { return "1" }
+
+/* And() is 1 and Or() is 1 as the empty Or succeeds */
+func (node AndNode) String() string { return join(node.Args, " * ", 2, "1") }
+
+func (node OrNode) String() string { return join(node.Args, " + ", 1, "1") }
+
+func (node NotNode) String() string { return "!" + operand(node.Arg, 3) }
+
+func (node StarNode) String() string { return operand(node.Arg, 4) + StarSymbol }
+
+func (node LeafNode) String() string {
+	if len(node.Params) == 0 {
+		return node.Name
+	}
+	var params = make([]string, len(node.Params))
+	for i, param := range node.Params {
+		params[i] = fmt.Sprint(param)
+	}
+	return node.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func Children(e Expr) []Expr {
+	switch node := e.(type) {
+	case AndNode:
+		return node.Args
+	case OrNode:
+		return node.Args
+	case NotNode:
+		return []Expr{node.Arg}
+	case StarNode:
+		return []Expr{node.Arg}
+	}
+	return nil
+}
+
+/* visits e depth first, children are skipped when visit returns false */
+func Walk(e Expr, visit func(Expr) bool) {
+	if visit(e) {
+		for _, child := range Children(e) {
+			Walk(child, visit)
+		}
+	}
+}
+
+/* structural equality, leaves compare by name and parameters */
+func Equal(a Expr, b Expr) bool {
+	switch x := a.(type) {
+	case LeafNode:
+		y, ok := b.(LeafNode)
+		return ok && x.Name == y.Name && reflect.DeepEqual(x.Params, y.Params)
+	case ZeroNode, OneNode:
+		return reflect.TypeOf(a) == reflect.TypeOf(b)
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	var left, right = Children(a), Children(b)
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if !Equal(left[i], right[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+)
+
+func TestExprString(t *testing.T) {
+	var p = Leaf("p",One)
+	var q = Leaf("q",Zero,1,"a")
+	var cases = map[string]Expr{
+		"0" : ZeroExpr,
+		"1" : AndExpr(),
+		"p * q(1, a)" : AndExpr(p,q),
+		"p + q(1, a)" : OrExpr(p,q),
+		"p * (p + q(1, a))" : AndExpr(p,OrExpr(p,q)),
+		"p * (p * p)" : AndExpr(p,AndExpr(p,p)),
+		"p + p * p" : OrExpr(p,AndExpr(p,p)),
+		"!(p + p)" : NotExpr(OrExpr(p,p)),
+		"(p + p)" + StarSymbol : StarExpr(OrExpr(p,p)),
+		"p" + StarSymbol + " * !p" : AndExpr(StarExpr(p),NotExpr(p)),
+	}
+	for expected, e := range cases {
+		if e.String() != expected {
+			t.Errorf("expr string : expected %v got %v",expected,e)
+		}
+	}
+}
+
+func TestExprCompile(t *testing.T) {
+	var ctx = context.Background()
+	assertContext(t,"expr : zero",TestFailed,ZeroExpr.Compile())(ctx,nil)
+	assertContext(t,"expr : one",Success,OneExpr.Compile())(ctx,nil)
+	assertContext(t,"expr : not zero",Success,NotExpr(ZeroExpr).Compile())(ctx,nil)
+	assertContext(t,"expr : and 1 p",Success,AndExpr(OneExpr,Leaf("p",One)).Compile())(ctx,nil)
+	var result = AndExpr(OneExpr,Leaf("q",Zero,2)).Compile()(ctx,nil)
+	if result.Kind != TestFailed || result.Step != "q(2)" {
+		t.Errorf("expr : expected q(2) to fail got %v",result)
+	}
+	if !CompileBool(OneExpr)(nil) || CompileBool(ZeroExpr)(nil) {
+		t.Errorf("expr : compile bool")
+	}
+	WithTestExpression(t,assertExpression(t,"expr : or 0 1",CompileBool(OrExpr(ZeroExpr,OneExpr))))
+}
+
+func TestExprWalkAndEqual(t *testing.T) {
+	var e = AndExpr(Leaf("p",One,1),OrExpr(Leaf("q",Zero),NotExpr(ZeroExpr)),StarExpr(OneExpr))
+	var count = 0
+	Walk(e,func(Expr) bool { count++; return true })
+	if count != 8 {
+		t.Errorf("expr walk : expected 8 nodes got %v",count)
+	}
+	count = 0
+	Walk(e,func(node Expr) bool { count++; _, ok := node.(OrNode); return !ok })
+	if count != 5 {
+		t.Errorf("expr walk : expected or to be skipped got %v",count)
+	}
+	if !Equal(e,AndExpr(Leaf("p",Zero,1),OrExpr(Leaf("q",Zero),NotExpr(ZeroExpr)),StarExpr(OneExpr))) {
+		t.Errorf("expr equal : expected equal")
+	}
+	if Equal(e,AndExpr(Leaf("p",One,2),OrExpr(Leaf("q",Zero),NotExpr(ZeroExpr)),StarExpr(OneExpr))) {
+		t.Errorf("expr equal : params differ")
+	}
+	if Equal(AndExpr(ZeroExpr),OrExpr(ZeroExpr)) || Equal(ZeroExpr,OneExpr) {
+		t.Errorf("expr equal : nodes differ")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+ control flow graphs of expressions. Leaves are boxes, a star is a
+ diamond its argument loops back to. Sequencing follows the success
+ edges, a failed branch of a choice takes a dashed rollback edge to
+ the next branch and a failed star iteration is rolled back and
+ leaves the loop.
+*/
+
+/* Hits overlays the number of evaluations of every leaf, see Tracer.Hits */
+type GraphOptions struct {
+	Hits map[string]int
+}
+
+type edgeKind int
+
+const (
+	successEdge edgeKind = iota
+	failureEdge
+	rollbackEdge
+	repeatEdge
+)
+
+type graphNode struct {
+	id    string
+	label string
+	shape string
+}
+
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+	kind  edgeKind
+}
+
+type graph struct {
+	nodes   []graphNode
+	edges   []graphEdge
+	options GraphOptions
+}
+
+/* where control goes next and how the edge there is drawn */
+type continuation struct {
+	id    string
+	label string
+	kind  edgeKind
+}
+
+func (g *graph) node(label string, shape string) string {
+	var id = fmt.Sprintf("n%d", len(g.nodes))
+	g.nodes = append(g.nodes, graphNode{id, label, shape})
+	return id
+}
+
+func (g *graph) edge(from string, to continuation) {
+	g.edges = append(g.edges, graphEdge{from, to.id, to.label, to.kind})
+}
+
+/* adds e and returns its entry, control leaves it at success or failure */
+func (g *graph) build(e Expr, success continuation, failure continuation) continuation {
+	switch node := e.(type) {
+	case ZeroNode:
+		return failure
+	case OneNode:
+		return success
+	case AndNode:
+		var next = success
+		for i := len(node.Args) - 1; i >= 0; i-- {
+			next = g.build(node.Args[i], next, failure)
+		}
+		return next
+	case OrNode:
+		if len(node.Args) == 0 {
+			return success
+		}
+		var next = failure
+		for i := len(node.Args) - 1; i >= 0; i-- {
+			next = g.build(node.Args[i], success, next)
+			if i > 0 {
+				next = continuation{next.id, "rollback", rollbackEdge}
+			}
+		}
+		return continuation{next.id, "", successEdge}
+	case NotNode:
+		return g.build(node.Arg, failure, success)
+	case StarNode:
+		var loop = g.node(StarSymbol, "diamond")
+		var entry = g.build(node.Arg, continuation{loop, "repeat", repeatEdge}, continuation{success.id, "rollback", rollbackEdge})
+		g.edge(loop, continuation{entry.id, "", successEdge})
+		return continuation{loop, "", successEdge}
+	case LeafNode:
+		var label = node.String()
+		if g.options.Hits != nil {
+			label = fmt.Sprintf("%v\nhits: %d", label, g.options.Hits[label])
+		}
+		var id = g.node(label, "box")
+		g.edge(id, continuation{success.id, success.label, success.kind})
+		var fail = failure
+		if fail.kind == successEdge {
+			fail.label, fail.kind = "fail", failureEdge
+		}
+		g.edge(id, fail)
+		return continuation{id, "", successEdge}
+	}
+	var id = g.node(e.String(), "box")
+	g.edge(id, success)
+	g.edge(id, failure)
+	return continuation{id, "", successEdge}
+}
+
+func newGraph(e Expr, options GraphOptions) *graph {
+	var g = &graph{options: options}
+	var start = g.node("start", "start")
+	var success = g.node("success", "end")
+	var failure = g.node("failure", "end")
+	var entry = g.build(e, continuation{success, "", successEdge}, continuation{failure, "", successEdge})
+	g.edge(start, continuation{entry.id, "", successEdge})
+	return g
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func DOT(e Expr, options GraphOptions) string {
+	var g = newGraph(e, options)
+	var builder strings.Builder
+	builder.WriteString("digraph kat {\n")
+	for _, node := range g.nodes {
+		var shape = node.shape
+		switch shape {
+		case "start":
+			shape = "circle"
+		case "end":
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(&builder, "  %v [label=\"%v\", shape=%v];\n", node.id, dotEscaper.Replace(node.label), shape)
+	}
+	for _, edge := range g.edges {
+		var attributes []string
+		if edge.label != "" {
+			attributes = append(attributes, fmt.Sprintf("label=\"%v\"", dotEscaper.Replace(edge.label)))
+		}
+		switch edge.kind {
+		case failureEdge:
+			attributes = append(attributes, "color=red")
+		case rollbackEdge:
+			attributes = append(attributes, "style=dashed")
+		case repeatEdge:
+			attributes = append(attributes, "style=bold")
+		}
+		if len(attributes) == 0 {
+			fmt.Fprintf(&builder, "  %v -> %v;\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&builder, "  %v -> %v [%v];\n", edge.from, edge.to, strings.Join(attributes, ", "))
+		}
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+
+func Mermaid(e Expr, options GraphOptions) string {
+	var g = newGraph(e, options)
+	var builder strings.Builder
+	builder.WriteString("flowchart TD\n")
+	for _, node := range g.nodes {
+		var label = mermaidEscaper.Replace(node.label)
+		switch node.shape {
+		case "start":
+			fmt.Fprintf(&builder, "  %v((\"%v\"))\n", node.id, label)
+		case "end":
+			fmt.Fprintf(&builder, "  %v(((\"%v\")))\n", node.id, label)
+		case "diamond":
+			fmt.Fprintf(&builder, "  %v{\"%v\"}\n", node.id, label)
+		default:
+			fmt.Fprintf(&builder, "  %v[\"%v\"]\n", node.id, label)
+		}
+	}
+	for _, edge := range g.edges {
+		var arrow = "-->"
+		switch edge.kind {
+		case rollbackEdge:
+			arrow = "-.->"
+		case repeatEdge:
+			arrow = "==>"
+		}
+		if edge.label == "" {
+			fmt.Fprintf(&builder, "  %v %v %v\n", edge.from, arrow, edge.to)
+		} else {
+			fmt.Fprintf(&builder, "  %v %v|%v| %v\n", edge.from, arrow, mermaidEscaper.Replace(edge.label), edge.to)
+		}
+	}
+	return builder.String()
+}
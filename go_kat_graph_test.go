@@ -0,0 +1,82 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"strings"
+)
+
+func TestDOT(t *testing.T) {
+	var p, q, r = Leaf("p",One), Leaf("q",Zero), Leaf("r",One)
+	var expected = `digraph kat {
+  n0 [label="start", shape=circle];
+  n1 [label="success", shape=doublecircle];
+  n2 [label="failure", shape=doublecircle];
+  n3 [label="r", shape=box];
+  n4 [label="q", shape=box];
+  n5 [label="p", shape=box];
+  n3 -> n1;
+  n3 -> n2 [label="fail", color=red];
+  n4 -> n1;
+  n4 -> n3 [label="rollback", style=dashed];
+  n5 -> n4;
+  n5 -> n2 [label="fail", color=red];
+  n0 -> n5;
+}
+`
+	if dot := DOT(AndExpr(p,OrExpr(q,r)),GraphOptions{}); dot != expected {
+		t.Errorf("dot : expected\n%v got\n%v",expected,dot)
+	}
+}
+
+func TestMermaidStar(t *testing.T) {
+	var expected = `flowchart TD
+  n0(("start"))
+  n1((("success")))
+  n2((("failure")))
+  n3{"⃰"}
+  n4["at(1, #quot;a#quot;)"]
+  n4 ==>|repeat| n3
+  n4 -.->|rollback| n1
+  n3 --> n4
+  n0 --> n3
+`
+	if mermaid := Mermaid(StarExpr(Leaf("at",One,1,`"a"`)),GraphOptions{}); mermaid != expected {
+		t.Errorf("mermaid : expected\n%v got\n%v",expected,mermaid)
+	}
+}
+
+func TestGraphConstants(t *testing.T) {
+	var p = Leaf("p",One)
+	for _, test := range []struct {
+		e        Expr
+		expected string
+	}{
+		{OneExpr,"n0 -> n1;"},
+		{ZeroExpr,"n0 -> n2;"},
+		{NotExpr(p),"n3 -> n1 [label=\"fail\", color=red];"},
+	} {
+		if dot := DOT(test.e,GraphOptions{}); !strings.Contains(dot,test.expected) {
+			t.Errorf("graph : %v expected %q in\n%v",test.e,test.expected,dot)
+		}
+	}
+}
+
+func TestGraphHits(t *testing.T) {
+	var p, q = Leaf("p",One), Leaf("q",Zero,2)
+	var tracer = NewTracer()
+	var ctx = WithTracer(context.Background(),tracer)
+	OrExpr(q,p).Compile()(ctx,NewFakeExecutor())
+	AndExpr(p,p).Compile()(ctx,NewFakeExecutor())
+	var hits = tracer.Hits()
+	if hits["p"] != 3 || hits["q(2)"] != 1 {
+		t.Errorf("hits : expected p 3 and q(2) 1 got %v",hits)
+	}
+	var dot = DOT(OrExpr(q,p),GraphOptions{Hits: hits})
+	for _, label := range []string{`"q(2)\nhits: 1"`,`"p\nhits: 3"`} {
+		if !strings.Contains(dot,label) {
+			t.Errorf("hits : expected %v in\n%v",label,dot)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"fmt"
+	"math/rand"
+	"database/sql"
+)
+
+/* a generated expression over the scratch schema together with its notation */
+type lawExpr struct {
+	text string
+	op   KatExpression
+}
+
+func (e lawExpr) String() string { return e.text }
+
+var lawSchema = And(ExecuteSQL("create table t (v integer)"),
+	            ExecuteSQL("create table budget (n integer)"),
+	            ExecuteSQL("insert into budget (n) values (6)"))
+
+func lawInsert(v int) lawExpr {
+	return lawExpr{fmt.Sprintf("insert(%d)",v),ExecuteSQL("insert into t (v) values (?)",v)}
+}
+
+func lawHas(v int) lawExpr {
+	return lawExpr{fmt.Sprintf("has(%d)",v),func(tx Executor) bool {
+		var result = false
+		return ExecuteQuery("select count(*) > 0 from t where v = ?",v)(&result)(tx) && result
+	}}
+}
+
+/* every successful iteration of a generated star spends budget so that it terminates */
+var lawTick = lawExpr{"tick",And(func(tx Executor) bool {
+	var result = false
+	return ExecuteQuery("select n > 0 from budget")(&result)(tx) && result
+},ExecuteSQL("update budget set n = n - 1"))}
+
+func lawAnd(args ...lawExpr) lawExpr {
+	var text, ops = "(", []KatExpression{}
+	for i, arg := range args {
+		if i > 0 {
+			text += " * "
+		}
+		text, ops = text + arg.text, append(ops,arg.op)
+	}
+	return lawExpr{text + ")",And(ops...)}
+}
+
+func lawOr(args ...lawExpr) lawExpr {
+	var text, ops = "(", []KatExpression{}
+	for i, arg := range args {
+		if i > 0 {
+			text += " + "
+		}
+		text, ops = text + arg.text, append(ops,arg.op)
+	}
+	return lawExpr{text + ")",Or(ops...)}
+}
+
+func lawNot(arg lawExpr) lawExpr { return lawExpr{"!" + arg.text,Not(arg.op)} }
+
+func lawStar(arg lawExpr) lawExpr {
+	var body = lawAnd(lawTick,arg)
+	return lawExpr{body.text + StarSymbol,Star(body.op)}
+}
+
+var lawZero = lawExpr{"0",Zero}
+
+var lawOne = lawExpr{"1",One}
+
+func randomLawExpr(random *rand.Rand,depth int) lawExpr {
+	if depth == 0 {
+		switch random.Intn(6) {
+		case 0:
+			return lawZero
+		case 1:
+			return lawOne
+		case 2, 3:
+			return lawHas(random.Intn(3))
+		}
+		return lawInsert(random.Intn(3))
+	}
+	switch random.Intn(6) {
+	case 0:
+		return lawAnd(randomLawExpr(random,depth-1),randomLawExpr(random,depth-1))
+	case 1:
+		return lawOr(randomLawExpr(random,depth-1),randomLawExpr(random,depth-1))
+	case 2:
+		return lawNot(randomLawExpr(random,depth-1))
+	case 3:
+		return lawStar(randomLawExpr(random,depth-1))
+	}
+	return randomLawExpr(random,0)
+}
+
+/* runs e on a fresh in memory database and returns its result and the committed state */
+func lawRun(t *testing.T,e lawExpr) (bool, string) {
+	db, err := sql.Open("sqlite3",":memory:")
+	if err != nil {
+		t.Fatalf("law : could not open database %v",err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if report := EvalDB(context.Background(),db,LiftContext(lawSchema)); !report.Committed {
+		t.Fatalf("law : could not create schema %v",report)
+	}
+	var report = EvalDB(context.Background(),db,LiftContext(e.op))
+	if report.Err != nil {
+		t.Fatalf("law : %v %v",e,report)
+	}
+	var state, v = "", 0
+	var read = func(tx Executor) bool {
+		return HandleQuery("select v from t order by rowid")(tx,func(){ state += fmt.Sprint(v," ") },&v) &&
+			ExecuteQuery("select n from budget")(&v)(tx)
+	}
+	if report := EvalDB(context.Background(),db,LiftContext(read)); !report.Committed {
+		t.Fatalf("law : could not read state %v",report)
+	}
+	return report.Committed, fmt.Sprintf("%v budget %v",state,v)
+}
+
+func checkLaw(t *testing.T,name string,law func(p, q, r lawExpr) (lawExpr, lawExpr)) {
+	var random = rand.New(rand.NewSource(int64(len(name))))
+	for i := 0; i < 100; i++ {
+		var left, right = law(randomLawExpr(random,2),randomLawExpr(random,2),randomLawExpr(random,2))
+		var leftResult, leftState = lawRun(t,left)
+		var rightResult, rightState = lawRun(t,right)
+		if leftResult != rightResult || leftState != rightState {
+			t.Errorf("law %v : %v => %v [%v] but %v => %v [%v]",
+				name,left,leftResult,leftState,right,rightResult,rightState)
+			return
+		}
+	}
+}
+
+func TestLawZeroChoice(t *testing.T) {
+	checkLaw(t,"0 + p = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawOr(lawZero,p), p })
+	checkLaw(t,"p + 0 = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawOr(p,lawZero), p })
+}
+
+func TestLawOneChoice(t *testing.T) {
+	checkLaw(t,"1 + p = 1",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawOr(lawOne,p), lawOne })
+}
+
+func TestLawIdempotentChoice(t *testing.T) {
+	checkLaw(t,"p + p = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawOr(p,p), p })
+}
+
+func TestLawUnitSequence(t *testing.T) {
+	checkLaw(t,"1 * p = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawAnd(lawOne,p), p })
+	checkLaw(t,"p * 1 = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawAnd(p,lawOne), p })
+}
+
+func TestLawZeroSequence(t *testing.T) {
+	checkLaw(t,"0 * p = 0",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawAnd(lawZero,p), lawZero })
+	checkLaw(t,"p * 0 = 0",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawAnd(p,lawZero), lawZero })
+}
+
+func TestLawAssociativity(t *testing.T) {
+	checkLaw(t,"(p q) r = p (q r)",func(p, q, r lawExpr) (lawExpr, lawExpr) {
+		return lawAnd(lawAnd(p,q),r), lawAnd(p,lawAnd(q,r))
+	})
+	checkLaw(t,"(p + q) + r = p + (q + r)",func(p, q, r lawExpr) (lawExpr, lawExpr) {
+		return lawOr(lawOr(p,q),r), lawOr(p,lawOr(q,r))
+	})
+}
+
+func TestLawDistributivity(t *testing.T) {
+	checkLaw(t,"p (q + r) = p q + p r",func(p, q, r lawExpr) (lawExpr, lawExpr) {
+		return lawAnd(p,lawOr(q,r)), lawOr(lawAnd(p,q),lawAnd(p,r))
+	})
+}
+
+/* under a negation a failed choice is not rolled back by Eval, the law only holds for a test p */
+func TestLawDistributivityNegated(t *testing.T) {
+	for v := 0; v < 2; v++ {
+		var test = lawHas(v)
+		checkLaw(t,"!(p (q + r)) = !(p q + p r)",func(p, q, r lawExpr) (lawExpr, lawExpr) {
+			return lawAnd(lawInsert(1),lawNot(lawAnd(test,lawOr(q,r)))),
+				lawAnd(lawInsert(1),lawNot(lawOr(lawAnd(test,q),lawAnd(test,r))))
+		})
+	}
+}
+
+func TestLawDoubleNegation(t *testing.T) {
+	checkLaw(t,"!!p = p",func(p, q, r lawExpr) (lawExpr, lawExpr) { return lawNot(lawNot(p)), p })
+}
+
+func TestLawStarUnfolding(t *testing.T) {
+	checkLaw(t,"p p" + StarSymbol + " + 1 = p" + StarSymbol,func(p, q, r lawExpr) (lawExpr, lawExpr) {
+		var star = lawStar(p)
+		return lawOr(lawAnd(lawTick,p,star),lawOne), star
+	})
+}
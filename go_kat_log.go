@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+/*
+ logging. The logger is carried by the context, slog.Default when
+ there is none. Every step is logged when it finishes : at debug when
+ it succeeds or its test fails, at warn when it is cancelled and at
+ error when it fails with an error. The result of an evaluation is
+ logged the same way when it is an error or a cancellation.
+*/
+
+type loggerKey struct{}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+func LoggerOf(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func logStep(ctx context.Context, name string, args []interface{}, result Result, elapsed time.Duration) {
+	var level = slog.LevelDebug
+	switch result.Kind {
+	case Errored:
+		level = slog.LevelError
+	case Cancelled:
+		level = slog.LevelWarn
+	}
+	var logger = LoggerOf(ctx)
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var attrs []slog.Attr
+	if len(args) > 0 {
+		var statement = strings.Join(strings.Fields(fmt.Sprint(args[0])), " ")
+		attrs = append(attrs, slog.String("statement", statement), slog.Any("args", args[1:]))
+	}
+	attrs = append(attrs, slog.Duration("duration", elapsed), slog.String("result", result.Kind.String()))
+	if result.Err != nil {
+		attrs = append(attrs, slog.String("error", result.Err.Error()))
+	}
+	logger.LogAttrs(ctx, level, name, attrs...)
+}
+
+/* an error at error level and a cancellation at warn level, any other result is not logged */
+func logResult(ctx context.Context, msg string, result Result) {
+	var level slog.Level
+	switch result.Kind {
+	case Errored:
+		level = slog.LevelError
+	case Cancelled:
+		level = slog.LevelWarn
+	default:
+		return
+	}
+	var attrs = []slog.Attr{slog.String("step", result.Step), slog.String("result", result.Kind.String())}
+	if result.Err != nil {
+		attrs = append(attrs, slog.String("error", result.Err.Error()))
+	}
+	LoggerOf(ctx).LogAttrs(ctx, level, msg, attrs...)
+}
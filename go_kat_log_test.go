@@ -0,0 +1,85 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+func testLogger(level slog.Level) (*slog.Logger, *bytes.Buffer) {
+	var buffer = &bytes.Buffer{}
+	var handler = slog.NewTextHandler(buffer,&slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string,attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey || attr.Key == "duration" {
+				return slog.Attr{}
+			}
+			return attr
+		}})
+	return slog.New(handler), buffer
+}
+
+func TestLogSteps(t *testing.T) {
+	logger, buffer := testLogger(slog.LevelDebug)
+	var fake = NewFakeExecutor().Fail("insert into b (b) VALUES (?)",errors.New("locked"))
+	var ctx = WithLogger(context.Background(),logger)
+	AndContext(ExecuteSQLContext("insert into a (a)\n   VALUES (?)",1),ExecuteSQLContext("insert into b (b) VALUES (?)",2))(ctx,fake)
+	var expected = "level=DEBUG msg=ExecuteSQL statement=\"insert into a (a) VALUES (?)\" args=[1] result=success\n" +
+		"level=ERROR msg=ExecuteSQL statement=\"insert into b (b) VALUES (?)\" args=[2] result=error error=locked\n"
+	if buffer.String() != expected {
+		t.Errorf("log : expected %q got %q",expected,buffer.String())
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	logger, buffer := testLogger(slog.LevelInfo)
+	var fake = NewFakeExecutor().Fail("insert into b (b) VALUES (1)",errors.New("locked"))
+	var ctx = WithLogger(context.Background(),logger)
+	ExecuteSQLContext("insert into a (a) VALUES (1)")(ctx,fake)
+	if buffer.Len() != 0 {
+		t.Errorf("log : expected statements hidden at info got %q",buffer.String())
+	}
+	ExecuteSQLContext("insert into b (b) VALUES (1)")(ctx,fake)
+	if !strings.Contains(buffer.String(),"level=ERROR") {
+		t.Errorf("log : expected error logged at info got %q",buffer.String())
+	}
+}
+
+func TestLogThroughBoolForm(t *testing.T) {
+	logger, buffer := testLogger(slog.LevelDebug)
+	var fake = NewFakeExecutor()
+	var ctx = WithLogger(context.Background(),logger)
+	LiftContext(Or(Zero,ExecuteSQL("insert into a (a) VALUES (1)")))(ctx,fake)
+	var lines = strings.Split(strings.TrimSpace(buffer.String()),"\n")
+	if len(lines) != 4 ||
+		!strings.Contains(lines[0],"msg=savepoint savepoint=kat_") ||
+		!strings.Contains(lines[1],"statement=\"rollback to savepoint kat_") ||
+		!strings.Contains(lines[2],"msg=ExecuteSQL") {
+		t.Errorf("log : expected the bool form to log to the context logger got %q",buffer.String())
+	}
+}
+
+func TestLogEvalResult(t *testing.T) {
+	WithTestFile(t,func(tmpfile string){
+		logger, buffer := testLogger(slog.LevelInfo)
+		var ctx = WithDebug(WithLogger(context.Background(),logger))
+		var writes = ReadOnlyLeafContext("writes",ExecuteSQLContext("create table a (a integer)"))
+		EvalLogged(ctx,"sqlite3",tmpfile,CompileBool(writes))
+		if !strings.Contains(buffer.String(),"level=ERROR msg=Lower step=writes result=error error=\"read-only writes wrote: create table a (a integer)\"") {
+			t.Errorf("log : expected the effect error logged got %q",buffer.String())
+		}
+	})
+	logger, buffer := testLogger(slog.LevelInfo)
+	var ctx, cancel = context.WithCancel(WithLogger(context.Background(),logger))
+	cancel()
+	logResult(ctx,"Eval",Interrupted("And",ctx.Err()))
+	logResult(ctx,"Eval",Failed("Zero"))
+	var expected = "level=WARN msg=Eval step=And result=cancelled error=\"context canceled\"\n"
+	if buffer.String() != expected {
+		t.Errorf("log : expected %q got %q",expected,buffer.String())
+	}
+}
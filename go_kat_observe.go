@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* what is being evaluated : a combinator, a leaf of an Expr or a statement */
+type SpanKind int
+
+const (
+	CombinatorSpan SpanKind = iota
+	LeafSpan
+	StatementSpan
+)
+
+func (kind SpanKind) String() string {
+	switch kind {
+	case CombinatorSpan:
+		return "combinator"
+	case LeafSpan:
+		return "leaf"
+	case StatementSpan:
+		return "statement"
+	}
+	return fmt.Sprintf("SpanKind(%d)", int(kind))
+}
+
+/* called around every combinator, leaf and statement of an evaluation */
+type Observer interface {
+	Enter(ctx context.Context, kind SpanKind, name string)
+	Exit(ctx context.Context, kind SpanKind, name string, result Result, elapsed time.Duration)
+}
+
+type observerKey struct{}
+
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+func observed(ctx context.Context, kind SpanKind, name string, op func() Result) Result {
+	observer, ok := ctx.Value(observerKey{}).(Observer)
+	if !ok {
+		return op()
+	}
+	observer.Enter(ctx, kind, name)
+	var start = time.Now()
+	var result = op()
+	observer.Exit(ctx, kind, name, result, time.Since(start))
+	return result
+}
+
+/* upper bounds in seconds of the duration buckets */
+var DurationBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type Histogram struct {
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+func (histogram *Histogram) observe(seconds float64) {
+	for i, bound := range DurationBuckets {
+		if seconds <= bound {
+			histogram.Counts[i]++
+		}
+	}
+	histogram.Sum += seconds
+	histogram.Count++
+}
+
+type spanKey struct {
+	kind SpanKind
+	name string
+}
+
+type countKey struct {
+	spanKey
+	result ResultKind
+}
+
+/* an Observer counting results and timing every kind and name */
+type Metrics struct {
+	lock      sync.Mutex
+	counts    map[countKey]int
+	durations map[spanKey]*Histogram
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{counts: map[countKey]int{}, durations: map[spanKey]*Histogram{}}
+}
+
+func (metrics *Metrics) Enter(ctx context.Context, kind SpanKind, name string) {}
+
+func (metrics *Metrics) Exit(ctx context.Context, kind SpanKind, name string, result Result, elapsed time.Duration) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	var key = spanKey{kind, name}
+	metrics.counts[countKey{key, result.Kind}]++
+	var histogram, ok = metrics.durations[key]
+	if !ok {
+		histogram = &Histogram{Counts: make([]uint64, len(DurationBuckets))}
+		metrics.durations[key] = histogram
+	}
+	histogram.observe(elapsed.Seconds())
+}
+
+/* how often name finished with result */
+func (metrics *Metrics) Count(kind SpanKind, name string, result ResultKind) int {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	return metrics.counts[countKey{spanKey{kind, name}, result}]
+}
+
+func (metrics *Metrics) Duration(kind SpanKind, name string) (Histogram, bool) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	histogram, ok := metrics.durations[spanKey{kind, name}]
+	if !ok {
+		return Histogram{}, false
+	}
+	return Histogram{append([]uint64(nil), histogram.Counts...), histogram.Sum, histogram.Count}, true
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func spanLabels(key spanKey) string {
+	return fmt.Sprintf(`kind="%v",name="%v"`, key.kind, labelEscaper.Replace(key.name))
+}
+
+/* writes the metrics in the Prometheus text exposition format */
+func (metrics *Metrics) WritePrometheus(w io.Writer) error {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	var counts []string
+	for key, count := range metrics.counts {
+		counts = append(counts, fmt.Sprintf("kat_evaluations_total{%v,result=\"%v\"} %d\n", spanLabels(key.spanKey), key.result, count))
+	}
+	sort.Strings(counts)
+	var keys []spanKey
+	for key := range metrics.durations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return spanLabels(keys[i]) < spanLabels(keys[j]) })
+	var builder strings.Builder
+	builder.WriteString("# HELP kat_evaluations_total Evaluations by kind, name and result.\n")
+	builder.WriteString("# TYPE kat_evaluations_total counter\n")
+	builder.WriteString(strings.Join(counts, ""))
+	builder.WriteString("# HELP kat_duration_seconds Evaluation time by kind and name.\n")
+	builder.WriteString("# TYPE kat_duration_seconds histogram\n")
+	for _, key := range keys {
+		var histogram = metrics.durations[key]
+		var labels = spanLabels(key)
+		for i, bound := range DurationBuckets {
+			fmt.Fprintf(&builder, "kat_duration_seconds_bucket{%v,le=\"%v\"} %d\n", labels, bound, histogram.Counts[i])
+		}
+		fmt.Fprintf(&builder, "kat_duration_seconds_bucket{%v,le=\"+Inf\"} %d\n", labels, histogram.Count)
+		fmt.Fprintf(&builder, "kat_duration_seconds_sum{%v} %v\n", labels, histogram.Sum)
+		fmt.Fprintf(&builder, "kat_duration_seconds_count{%v} %d\n", labels, histogram.Count)
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func (metrics *Metrics) WritePrometheusFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := metrics.WritePrometheus(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
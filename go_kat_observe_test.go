@@ -0,0 +1,113 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (observer *recordingObserver) Enter(ctx context.Context,kind SpanKind,name string) {
+	observer.events = append(observer.events,fmt.Sprintf("enter %v %v",kind,name))
+}
+
+func (observer *recordingObserver) Exit(ctx context.Context,kind SpanKind,name string,result Result,elapsed time.Duration) {
+	observer.events = append(observer.events,fmt.Sprintf("exit %v %v %v",kind,name,result.Kind))
+}
+
+func TestObserverEvents(t *testing.T) {
+	var observer = &recordingObserver{}
+	var ctx = WithObserver(context.Background(),observer)
+	var expr = AndExpr(Leaf("one",One),LeafContext("insert",ExecuteSQLContext("insert into a (a) VALUES (1)")))
+	expr.Compile()(ctx,NewFakeExecutor())
+	var expected = []string{"enter combinator And",
+		                "enter leaf one",
+		                "exit leaf one success",
+		                "enter leaf insert",
+		                "enter statement ExecuteSQL",
+		                "exit statement ExecuteSQL success",
+		                "exit leaf insert success",
+		                "exit combinator And success"}
+	if strings.Join(observer.events,"\n") != strings.Join(expected,"\n") {
+		t.Errorf("observer : expected %v got %v",expected,observer.events)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var metrics = NewMetrics()
+	var ctx = WithObserver(context.Background(),metrics)
+	var fake = NewFakeExecutor()
+	OrContext(ZeroContext,OneContext)(ctx,fake)
+	OrContext(ZeroContext,OneContext)(ctx,fake)
+	if n := metrics.Count(CombinatorSpan,"Or",Success); n != 2 {
+		t.Errorf("metrics : expected two or got %v",n)
+	}
+	if n := metrics.Count(StatementSpan,"rollback to savepoint",Success); n != 2 {
+		t.Errorf("metrics : expected two rollbacks got %v",n)
+	}
+	histogram, ok := metrics.Duration(StatementSpan,"savepoint")
+	if !ok || histogram.Count != 2 || histogram.Counts[len(DurationBuckets) - 1] != 2 {
+		t.Errorf("metrics : expected two savepoint durations got %v",histogram)
+	}
+}
+
+func TestMetricsPrometheus(t *testing.T) {
+	var metrics = NewMetrics()
+	metrics.Exit(context.Background(),LeafSpan,`say "hi"`,Failed("x"),time.Millisecond)
+	var buffer bytes.Buffer
+	if err := metrics.WritePrometheus(&buffer); err != nil {
+		t.Fatalf("metrics : %v",err)
+	}
+	var text = buffer.String()
+	for _, line := range []string{"# TYPE kat_evaluations_total counter",
+		                      `kat_evaluations_total{kind="leaf",name="say \"hi\"",result="test failed"} 1`,
+		                      "# TYPE kat_duration_seconds histogram",
+		                      `kat_duration_seconds_bucket{kind="leaf",name="say \"hi\"",le="0.0005"} 0`,
+		                      `kat_duration_seconds_bucket{kind="leaf",name="say \"hi\"",le="0.001"} 1`,
+		                      `kat_duration_seconds_bucket{kind="leaf",name="say \"hi\"",le="+Inf"} 1`,
+		                      `kat_duration_seconds_count{kind="leaf",name="say \"hi\""} 1`} {
+		if !strings.Contains(text,line + "\n") {
+			t.Errorf("metrics : expected %v in\n%v",line,text)
+		}
+	}
+}
+
+func TestObserverBoolCombinators(t *testing.T) {
+	var metrics = NewMetrics()
+	var entries = []Entry{{1, 2, 10},{2, 3, 200},{3, 1, 5}}
+	WithTestFile(t,func(tmpfile string){
+		var report = EvalOpen(WithObserver(context.Background(),metrics),"sqlite3",tmpfile,
+			LiftContext(And(CreateSchema,SaveBatch(entries),BatchEntry)))
+		if !report.Result.Ok() {
+			t.Fatalf("observe : expected success got %v",report)
+		}
+	})
+	var counts = []struct {
+		kind     SpanKind
+		name     string
+		result   ResultKind
+		expected int
+	}{
+		{CombinatorSpan,"Star",Success,1},
+		{LeafSpan,"saveTransaction",Success,3},
+		{LeafSpan,"senderPositiveBalance",TestFailed,1},
+		{LeafSpan,"receiverPositiveBalance",Success,2},
+		{LeafSpan,"quarantineTransaction",Success,1},
+		{StatementSpan,"rollback to savepoint",Success,2},
+	}
+	for _, count := range counts {
+		if got := metrics.Count(count.kind,count.name,count.result); got != count.expected {
+			t.Errorf("observe : expected %v %v %v %d times got %d",count.kind,count.name,count.result,count.expected,got)
+		}
+	}
+	if metrics.Count(CombinatorSpan,"And",Success) == 0 || metrics.Count(CombinatorSpan,"Or",Success) == 0 {
+		t.Errorf("observe : expected the bool and and or combinators to be observed")
+	}
+}
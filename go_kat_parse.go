@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ parses the notation of the README back into an Expr :
+
+   expr    = product { "+" product }
+   product = unary { "*" unary }
+   unary   = "!" unary | postfix
+   postfix = primary { "⃰" }
+   primary = "0" | "1" | "(" expr ")" | name [ "(" [ literal { "," literal } ] ")" ]
+
+ literals are integers, floats, true, false and strings. Names
+ are resolved in a Registry of Go constructors called with the
+ literals as arguments.
+*/
+
+/* where the text could not be parsed, Line and Column count from 1 */
+type ParseError struct {
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Msg)
+}
+
+var (
+	katExpressionType        = reflect.TypeOf(KatExpression(nil))
+	katContextExpressionType = reflect.TypeOf(KatContextExpression(nil))
+)
+
+/* atoms by name : a KatExpression, a KatContextExpression or a function returning one */
+type Registry struct {
+	atoms   map[string]reflect.Value
+	effects map[string]Effect
+}
+
+func NewRegistry() *Registry {
+	return &Registry{atoms: map[string]reflect.Value{}, effects: map[string]Effect{}}
+}
+
+func isExpressionType(t reflect.Type) bool {
+	return t.ConvertibleTo(katExpressionType) || t.ConvertibleTo(katContextExpressionType)
+}
+
+/* panics when atom is neither an expression nor a function returning one */
+func (registry *Registry) Register(name string, atom interface{}) *Registry {
+	return registry.register(name, atom, Mutating)
+}
+
+/* registers a test, its leaves are read-only */
+func (registry *Registry) RegisterReadOnly(name string, atom interface{}) *Registry {
+	return registry.register(name, atom, ReadOnly)
+}
+
+func (registry *Registry) register(name string, atom interface{}, effect Effect) *Registry {
+	var value = reflect.ValueOf(atom)
+	if !value.IsValid() {
+		panic(fmt.Sprintf("kat: atom %v is nil", name))
+	}
+	var t = value.Type()
+	var constructor = t.Kind() == reflect.Func && t.NumOut() == 1 && isExpressionType(t.Out(0))
+	if !constructor && !isExpressionType(t) {
+		panic(fmt.Sprintf("kat: atom %v of type %v is not an expression or a constructor of one", name, t))
+	}
+	registry.atoms[name] = value
+	registry.effects[name] = effect
+	return registry
+}
+
+func (registry *Registry) Parse(text string) (Expr, error) {
+	var parser = &parser{text: text, registry: registry}
+	parser.skip()
+	var e = parser.expr()
+	if parser.err == nil && parser.offset < len(text) {
+		parser.fail(parser.offset, "unexpected %q", parser.peekRune())
+	}
+	if parser.err != nil {
+		return nil, parser.err
+	}
+	return e, nil
+}
+
+type parser struct {
+	text     string
+	offset   int
+	registry *Registry
+	err      *ParseError
+}
+
+func (parser *parser) fail(offset int, format string, args ...interface{}) {
+	if parser.err != nil {
+		return
+	}
+	var before = parser.text[:offset]
+	var line = strings.Count(before, "\n") + 1
+	var column = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	parser.err = &ParseError{offset, line, column, fmt.Sprintf(format, args...)}
+}
+
+func (parser *parser) peekRune() rune {
+	r, _ := utf8.DecodeRuneInString(parser.text[parser.offset:])
+	return r
+}
+
+func (parser *parser) skip() {
+	for parser.offset < len(parser.text) {
+		r, size := utf8.DecodeRuneInString(parser.text[parser.offset:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		parser.offset += size
+	}
+}
+
+/* consumes token and the space after it when the text continues with it */
+func (parser *parser) accept(token string) bool {
+	if parser.err == nil && strings.HasPrefix(parser.text[parser.offset:], token) {
+		parser.offset += len(token)
+		parser.skip()
+		return true
+	}
+	return false
+}
+
+func (parser *parser) expect(token string) {
+	if !parser.accept(token) {
+		parser.fail(parser.offset, "expected %q", token)
+	}
+}
+
+func (parser *parser) atEnd() bool {
+	return parser.err != nil || parser.offset >= len(parser.text)
+}
+
+func (parser *parser) expr() Expr {
+	var args = []Expr{parser.product()}
+	for parser.accept("+") {
+		args = append(args, parser.product())
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	return OrExpr(args...)
+}
+
+func (parser *parser) product() Expr {
+	var args = []Expr{parser.unary()}
+	for parser.accept("*") {
+		args = append(args, parser.unary())
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	return AndExpr(args...)
+}
+
+func (parser *parser) unary() Expr {
+	if parser.accept("!") {
+		return NotExpr(parser.unary())
+	}
+	var e = parser.primary()
+	for parser.accept(StarSymbol) {
+		e = StarExpr(e)
+	}
+	return e
+}
+
+func (parser *parser) primary() Expr {
+	if parser.atEnd() {
+		parser.fail(parser.offset, "expected an expression")
+		return ZeroExpr
+	}
+	var start = parser.offset
+	switch r := parser.peekRune(); {
+	case parser.accept("("):
+		var e = parser.expr()
+		parser.expect(")")
+		return e
+	case r == '0' || r == '1':
+		var literal = parser.literal()
+		if literal == 0 {
+			return ZeroExpr
+		} else if literal == 1 {
+			return OneExpr
+		}
+		parser.fail(start, "expected 0 or 1 got %v", literal)
+		return ZeroExpr
+	case unicode.IsLetter(r) || r == '_':
+		return parser.atom()
+	}
+	parser.fail(start, "unexpected %q", parser.peekRune())
+	return ZeroExpr
+}
+
+func (parser *parser) name() string {
+	var start = parser.offset
+	for parser.offset < len(parser.text) {
+		r, size := utf8.DecodeRuneInString(parser.text[parser.offset:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		parser.offset += size
+	}
+	return parser.text[start:parser.offset]
+}
+
+func (parser *parser) atom() Expr {
+	var start = parser.offset
+	var name = parser.name()
+	var params []interface{}
+	var positions []int
+	parser.skip()
+	if parser.accept("(") {
+		for !parser.accept(")") {
+			if len(params) > 0 {
+				parser.expect(",")
+			}
+			if parser.atEnd() {
+				parser.fail(parser.offset, "expected %q", ")")
+				return ZeroExpr
+			}
+			positions = append(positions, parser.offset)
+			params = append(params, parser.literal())
+		}
+	}
+	if parser.err != nil {
+		return ZeroExpr
+	}
+	return parser.resolve(start, name, params, positions)
+}
+
+/* an integer, a float, true, false or a string, quoted or a bare word as the printer leaves it */
+func (parser *parser) literal() interface{} {
+	var start = parser.offset
+	var rest = parser.text[start:]
+	if strings.HasPrefix(rest, `"`) {
+		var end = 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			parser.fail(start, "unterminated string")
+			return nil
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			parser.fail(start, "invalid string: %v", err)
+			return nil
+		}
+		parser.offset += end + 1
+		parser.skip()
+		return value
+	}
+	var end = strings.IndexFunc(rest, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-' && r != '_'
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	var token = rest[:end]
+	parser.offset += end
+	parser.skip()
+	if value, err := strconv.Atoi(token); err == nil {
+		return value
+	} else if value, err := strconv.ParseFloat(token, 64); err == nil && numeric(token) {
+		return value
+	} else if value, err := strconv.ParseBool(token); err == nil && (token == "true" || token == "false") {
+		return value
+	}
+	if token == "" {
+		parser.fail(start, "expected a literal")
+		return nil
+	}
+	return token
+}
+
+/* whether token is written as a number, ParseFloat also reads inf and nan which stay bare words */
+func numeric(token string) bool {
+	var unsigned = strings.TrimPrefix(token, "-")
+	return unsigned != "" && (unsigned[0] == '.' || (unsigned[0] >= '0' && unsigned[0] <= '9'))
+}
+
+func literalConvertible(value reflect.Value, t reflect.Type) bool {
+	switch value.Kind() {
+	case reflect.Int, reflect.Float64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return value.Kind() == reflect.Int || t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+		}
+	case reflect.String:
+		return t.Kind() == reflect.String
+	case reflect.Bool:
+		return t.Kind() == reflect.Bool
+	}
+	return t.Kind() == reflect.Interface && value.Type().Implements(t)
+}
+
+/* whether a literal that converts to t loses its value, a negative int is out of range of an unsigned t */
+func literalOverflows(value reflect.Value, t reflect.Type) bool {
+	var zero = reflect.Zero(t)
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return zero.OverflowInt(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Int() < 0 || zero.OverflowUint(uint64(value.Int()))
+	case reflect.Float32:
+		if value.Kind() == reflect.Float64 {
+			return zero.OverflowFloat(value.Float())
+		}
+	}
+	return false
+}
+
+/* calls the constructor registered for name and wraps it in a leaf */
+func (parser *parser) resolve(start int, name string, params []interface{}, positions []int) Expr {
+	atom, ok := parser.registry.atoms[name]
+	if !ok {
+		parser.fail(start, "unknown atom %v", name)
+		return ZeroExpr
+	}
+	var t = atom.Type()
+	if isExpressionType(t) {
+		if len(params) > 0 {
+			parser.fail(start, "%v takes no arguments, got %d", name, len(params))
+			return ZeroExpr
+		}
+		return leafOf(name, atom, params, parser.registry.effects[name])
+	}
+	var fixed = t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+	}
+	if len(params) < fixed || (!t.IsVariadic() && len(params) > fixed) {
+		parser.fail(start, "%v takes %d arguments, got %d", name, fixed, len(params))
+		return ZeroExpr
+	}
+	var args = make([]reflect.Value, len(params))
+	for i, param := range params {
+		var in reflect.Type
+		if i < fixed {
+			in = t.In(i)
+		} else {
+			in = t.In(fixed).Elem()
+		}
+		var value = reflect.ValueOf(param)
+		if !literalConvertible(value, in) {
+			parser.fail(positions[i], "argument %d of %v must be %v, got %v", i+1, name, in, value.Type())
+			return ZeroExpr
+		}
+		if literalOverflows(value, in) {
+			parser.fail(positions[i], "argument %d of %v: %v is out of range of %v", i+1, name, param, in)
+			return ZeroExpr
+		}
+		args[i] = value.Convert(in)
+	}
+	return leafOf(name, atom.Call(args)[0], params, parser.registry.effects[name])
+}
+
+func leafOf(name string, op reflect.Value, params []interface{}, effect Effect) Expr {
+	if op.Type().ConvertibleTo(katContextExpressionType) {
+		return LeafNode{name, params, op.Convert(katContextExpressionType).Interface().(KatContextExpression), effect}
+	}
+	return LeafNode{name, params, LiftContext(op.Convert(katExpressionType).Interface().(KatExpression)), effect}
+}
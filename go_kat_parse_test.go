@@ -0,0 +1,100 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+)
+
+func testRegistry() *Registry {
+	return NewRegistry().
+		Register("p",One).
+		Register("q",Zero).
+		Register("c",OneContext).
+		Register("at",func(n int,name string) KatExpression { return One }).
+		Register("many",func(names ...string) KatContextExpression { return OneContext }).
+		Register("small",func(id uint, n int8, x float32) KatExpression { return One })
+}
+
+func TestParse(t *testing.T) {
+	var p, q = Leaf("p",One), Leaf("q",Zero)
+	var tests = []struct {
+		text     string
+		expected Expr
+	}{
+		{"0",ZeroExpr},
+		{" 1 ",OneExpr},
+		{"p * q + !p",OrExpr(AndExpr(p,q),NotExpr(p))},
+		{"p * (q + p)",AndExpr(p,OrExpr(q,p))},
+		{"(p * q) * p",AndExpr(AndExpr(p,q),p)},
+		{"!p⃰",NotExpr(StarExpr(p))},
+		{"(!p) ⃰ ⃰",StarExpr(StarExpr(NotExpr(p)))},
+		{"at(1, a) *\n at(-2, \"b c\")",AndExpr(Leaf("at",One,1,"a"),Leaf("at",One,-2,"b c"))},
+		{"many() + many(x, y)",OrExpr(Leaf("many",One),Leaf("many",One,"x","y"))},
+		{"small(0, -128, 1.5)",Leaf("small",One,0,-128,1.5)},
+	}
+	for _, test := range tests {
+		e, err := testRegistry().Parse(test.text)
+		if err != nil {
+			t.Errorf("parse : %q failed %v",test.text,err)
+		} else if !Equal(e,test.expected) {
+			t.Errorf("parse : %q expected %v got %v",test.text,test.expected,e)
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, e := range []Expr{ProcessEntryExpr(4,Entry{1, 2, 10}),RemoveBatchExpr(7),EnsureSenderExpr(Entry{3, 4, 5})} {
+		parsed, err := LedgerAtoms.Parse(e.String())
+		if err != nil {
+			t.Errorf("parse : %v failed %v",e,err)
+		} else if !Equal(parsed,e) || parsed.String() != e.String() {
+			t.Errorf("parse : expected %v got %v",e,parsed)
+		}
+	}
+	var words = Leaf("many",One,"inf","NaN","-Infinity","x")
+	if parsed, err := testRegistry().Parse(words.String()); err != nil || !Equal(parsed,words) {
+		t.Errorf("parse : expected %v got %v %v",words,parsed,err)
+	}
+}
+
+func TestParseEvaluates(t *testing.T) {
+	e, err := testRegistry().Parse("c * (q + p)")
+	if err != nil {
+		t.Fatalf("parse : %v",err)
+	}
+	if r := e.Compile()(context.Background(),NewFakeExecutor()); !r.Ok() {
+		t.Errorf("parse : expected parsed expression to hold got %v",r)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected string
+	}{
+		{"","1:1: expected an expression"},
+		{"p *","1:4: expected an expression"},
+		{"p * (q + p","1:11: expected \")\""},
+		{"p q","1:3: unexpected 'q'"},
+		{"p *\n  r","2:3: unknown atom r"},
+		{"p(1)","1:1: p takes no arguments, got 1"},
+		{"at(1)","1:1: at takes 2 arguments, got 1"},
+		{"at(1, 2)","1:7: argument 2 of at must be string, got int"},
+		{"at(x, y)","1:4: argument 1 of at must be int, got string"},
+		{"at(1, \"a)","1:7: unterminated string"},
+		{"2","1:1: unexpected '2'"},
+		{"10","1:1: expected 0 or 1 got 10"},
+		{"p ⃰ + ) ","1:7: unexpected ')'"},
+		{"small(-1, 1, 1)","1:7: argument 1 of small: -1 is out of range of uint"},
+		{"small(1, 200, 1)","1:10: argument 2 of small: 200 is out of range of int8"},
+		{"small(1, -129, 1)","1:10: argument 2 of small: -129 is out of range of int8"},
+		{"small(1, 2, 1e40)","1:13: argument 3 of small: 1e+40 is out of range of float32"},
+	}
+	for _, test := range tests {
+		_, err := testRegistry().Parse(test.text)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("parse : %q expected error %v got %v",test.text,test.expected,err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+ quantifiers over the rows of a query. All the rows are loaded into
+ memory before the body runs so the body is free to change the tables
+ they came from, no cursor is open while it runs. The whole result is
+ read even when ForAll or Exists stop at the first row, bound the
+ query or use QueryEach where that matters. Every row runs in its own
+ savepoint and a row that fails is rolled back on its own. An error or
+ cancellation stops the iteration.
+*/
+
+/* how the body did on one row, collected in EvalReport.Rows */
+type RowOutcome struct {
+	Quantifier string
+	Query      string
+	Index      int
+	Row        interface{}
+	Result     Result
+}
+
+func recordRow(ctx context.Context, outcome RowOutcome) {
+	if recorder, ok := ctx.Value(stepsKey{}).(*stepRecorder); ok {
+		recorder.lock.Lock()
+		recorder.rows = append(recorder.rows, outcome)
+		recorder.lock.Unlock()
+	}
+}
+
+/* loads the rows then applies body to each until one satisfies until, otherwise returns end */
+func quantify[T any](name string, until func(Result) bool, end Result, body func(T) KatContextExpression, query string, args []interface{}) KatContextExpression {
+	return traced(name, func(ctx context.Context, tx Executor) Result {
+		var rows []T
+		if r := QuerySlice(&rows, query, args...)(ctx, tx); !r.Ok() {
+			return r
+		}
+		for i, row := range rows {
+			if err := ctx.Err(); err != nil {
+				return Interrupted(name, err)
+			}
+			var result = inSavepoint(ctx, tx, body(row))
+			recordRow(ctx, RowOutcome{name, query, i, row, result})
+			if result.Kind == Errored || result.Kind == Cancelled {
+				return result
+			} else if until != nil && until(result) {
+				return result
+			}
+		}
+		return end
+	})
+}
+
+/* applies body to every row, rows that fail are rolled back and skipped */
+func ForEachRow[T any](body func(T) KatContextExpression, query string, args ...interface{}) KatContextExpression {
+	return quantify(fmt.Sprintf("ForEachRow[%T]", *new(T)), nil, Passed(), body, query, args)
+}
+
+/* holds when body holds for every row, stopping at the first row that fails */
+func ForAll[T any](body func(T) KatContextExpression, query string, args ...interface{}) KatContextExpression {
+	var failed = func(r Result) bool { return !r.Ok() }
+	return quantify(fmt.Sprintf("ForAll[%T]", *new(T)), failed, Passed(), body, query, args)
+}
+
+/* holds when body holds for some row, stopping at the first row that passes */
+func Exists[T any](body func(T) KatContextExpression, query string, args ...interface{}) KatContextExpression {
+	var passed = func(r Result) bool { return r.Ok() }
+	var none = Failed(fmt.Sprintf("Exists: %v %v", query, args))
+	return quantify(fmt.Sprintf("Exists[%T]", *new(T)), passed, none, body, query, args)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"database/sql"
+)
+
+func withNumbers(t *testing.T,test func(*sql.DB)) {
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table n (n integer)"),
+			                                               ExecuteSQLContext("create table seen (n integer)"),
+			                                               ExecuteSQLContext("insert into n (n) VALUES (1),(2),(3)")))
+		if !report.Committed {
+			t.Fatalf("quantifier : could not create numbers %v",report)
+		}
+		test(db)
+	})
+}
+
+/* records n then holds when n is below limit */
+func seenBelow(limit int) func(int) KatContextExpression {
+	return func(n int) KatContextExpression {
+		var below = func(ctx context.Context,tx Executor) Result {
+			if n < limit {
+				return Passed()
+			}
+			return Failed("below")
+		}
+		return AndContext(ExecuteSQLContext("insert into seen (n) VALUES (?)",n),below)
+	}
+}
+
+func seenRows(t *testing.T,db *sql.DB) []int {
+	var seen []int
+	EvalDB(context.Background(),db,QuerySlice(&seen,"select n from seen order by n"))
+	return seen
+}
+
+func TestForEachRow(t *testing.T) {
+	withNumbers(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,ForEachRow(seenBelow(3),"select n from n order by n"))
+		if !report.Committed || len(report.Rows) != 3 {
+			t.Fatalf("for each : expected three outcomes got %v",report)
+		}
+		if report.Rows[2].Result.Kind != TestFailed || report.Rows[2].Row != 3 || report.Rows[0].Result.Kind != Success {
+			t.Errorf("for each : unexpected outcomes %v",report.Rows)
+		}
+		if seen := seenRows(t,db); len(seen) != 2 {
+			t.Errorf("for each : expected failed row rolled back got %v",seen)
+		}
+	})
+}
+
+func TestForAll(t *testing.T) {
+	withNumbers(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,ForAll(seenBelow(4),"select n from n"))
+		if !report.Committed {
+			t.Errorf("for all : expected all rows to hold got %v",report)
+		}
+		report = EvalDB(context.Background(),db,ForAll(seenBelow(2),"select n from n order by n"))
+		if report.Committed || report.Result.Kind != TestFailed || len(report.Rows) != 2 {
+			t.Errorf("for all : expected to stop at the second row got %v %v",report,report.Rows)
+		}
+		if seen := seenRows(t,db); len(seen) != 3 {
+			t.Errorf("for all : expected only the first run committed got %v",seen)
+		}
+		report = EvalDB(context.Background(),db,ForAll(seenBelow(0),"select n from n where n > 3"))
+		if !report.Result.Ok() {
+			t.Errorf("for all : expected no rows to hold got %v",report)
+		}
+	})
+}
+
+func TestExists(t *testing.T) {
+	withNumbers(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,Exists(seenBelow(3),"select n from n order by n desc"))
+		if !report.Committed || len(report.Rows) != 2 {
+			t.Errorf("exists : expected to stop at the second row got %v %v",report,report.Rows)
+		}
+		if seen := seenRows(t,db); len(seen) != 1 || seen[0] != 2 {
+			t.Errorf("exists : expected the failed row rolled back got %v",seen)
+		}
+		report = EvalDB(context.Background(),db,Exists(seenBelow(0),"select n from n"))
+		if report.Result.Kind != TestFailed || len(report.Rows) != 3 {
+			t.Errorf("exists : expected no row to hold got %v",report)
+		}
+	})
+}
+
+func TestQuantifierErrorStops(t *testing.T) {
+	var fake = NewFakeExecutor().Answer("select n from n",[]interface{}{1},[]interface{}{2})
+	var count = 0
+	var broken = func(n int) KatContextExpression {
+		return func(ctx context.Context,tx Executor) Result {
+			count = count + 1
+			return Faulted("broken",errors.New("broken"))
+		}
+	}
+	var result = ForEachRow(broken,"select n from n")(context.Background(),fake)
+	if result.Kind != Errored || count != 1 {
+		t.Errorf("quantifier : expected error to stop got %v after %v",result,count)
+	}
+	var queries = fake.Queries()
+	if len(queries) != 4 || queries[3][:17] != "release savepoint" {
+		t.Errorf("quantifier : expected row savepoint discarded got %v",queries)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+ typed queries. A row is scanned into T : scalars directly, structs
+ field by field where a field is matched to a column by its kat tag
+ or its name. Fields tagged kat:"-" are skipped. When the rows do not
+ report their columns the fields are scanned in declaration order.
+*/
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+func isStructRow(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct &&
+		t != reflect.TypeOf(time.Time{}) &&
+		!reflect.PtrTo(t).Implements(scannerType)
+}
+
+type rowField struct {
+	name  string
+	index int
+}
+
+func rowFields(t reflect.Type) []rowField {
+	var fields []rowField
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		var name = field.Tag.Get("kat")
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, rowField{name, i})
+	}
+	return fields
+}
+
+func scanTargets(dest reflect.Value, columns []string) ([]interface{}, error) {
+	var value = dest.Elem()
+	if !isStructRow(value.Type()) {
+		return []interface{}{dest.Interface()}, nil
+	}
+	var fields = rowFields(value.Type())
+	if len(columns) == 0 {
+		var targets = make([]interface{}, len(fields))
+		for i, field := range fields {
+			targets[i] = value.Field(field.index).Addr().Interface()
+		}
+		return targets, nil
+	}
+	var targets = make([]interface{}, len(columns))
+	for i, column := range columns {
+		for _, field := range fields {
+			if strings.EqualFold(field.name, column) {
+				targets[i] = value.Field(field.index).Addr().Interface()
+			}
+		}
+		if targets[i] == nil {
+			return nil, fmt.Errorf("no field of %v for column %v", value.Type(), column)
+		}
+	}
+	return targets, nil
+}
+
+/* calls each with at most limit rows, all of them when limit is 0, until it does not succeed */
+func queryRows[T any](name string, query string, args []interface{}, limit int, each func(T) Result) KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var step = fmt.Sprintf("%v: %v %v", name, query, args)
+		return traceStep(ctx, name, append([]interface{}{query}, args...), func() Result {
+			rows, err := tx.Query(ctx, query, args...)
+			if err != nil {
+				return contextFault(ctx, step, err)
+			}
+			defer rows.Close()
+			columns, err := rows.Columns()
+			if err != nil {
+				return contextFault(ctx, step, err)
+			}
+			for n := 0; (limit == 0 || n < limit) && rows.Next(); n++ {
+				var row T
+				targets, err := scanTargets(reflect.ValueOf(&row), columns)
+				if err != nil {
+					return Faulted(step, err)
+				}
+				if err := rows.Scan(targets...); err != nil {
+					return contextFault(ctx, step, err)
+				}
+				if r := each(row); !r.Ok() {
+					return r
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return contextFault(ctx, step, err)
+			}
+			return Passed()
+		})
+	}
+}
+
+/* scans the first row into dest, fails when there is none */
+func QueryValue[T any](dest *T, query string, args ...interface{}) KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var found = false
+		var r = queryRows(fmt.Sprintf("QueryValue[%T]", *dest), query, args, 1, func(row T) Result {
+			*dest, found = row, true
+			return Passed()
+		})(ctx, tx)
+		if r.Ok() && !found {
+			return Failed(fmt.Sprintf("QueryValue: %v %v", query, args))
+		}
+		return r
+	}
+}
+
+/* replaces *dest with all the rows */
+func QuerySlice[T any](dest *[]T, query string, args ...interface{}) KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var rows = []T{}
+		var r = queryRows(fmt.Sprintf("QuerySlice[%T]", *new(T)), query, args, 0, func(row T) Result {
+			rows = append(rows, row)
+			return Passed()
+		})(ctx, tx)
+		if r.Ok() {
+			*dest = rows
+		}
+		return r
+	}
+}
+
+/* streams the rows to handler, stopping at the first row it does not accept */
+func QueryEach[T any](handler func(T) Result, query string, args ...interface{}) KatContextExpression {
+	return queryRows(fmt.Sprintf("QueryEach[%T]", *new(T)), query, args, 0, handler)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"strings"
+	"database/sql"
+)
+
+type queryRow struct {
+	Name    string `kat:"name"`
+	Amount  int
+	Ignored int `kat:"-"`
+}
+
+func TestQueryStructByColumn(t *testing.T) {
+	var rows []queryRow
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table q (amount integer, name text)"),
+			                                  ExecuteSQLContext("insert into q (amount,name) VALUES (1,'a'),(2,'b')")))
+		var report = EvalDB(context.Background(),db,QuerySlice(&rows,"select amount, name from q order by amount"))
+		if !report.Result.Ok() {
+			t.Fatalf("query : expected slice got %v",report.Result)
+		}
+	})
+	if len(rows) != 2 || rows[0] != (queryRow{"a",1,0}) || rows[1] != (queryRow{"b",2,0}) {
+		t.Errorf("query : expected rows a 1 and b 2 got %v",rows)
+	}
+}
+
+func TestQueryValue(t *testing.T) {
+	var count = -1
+	var row queryRow
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table q (amount integer, name text)"),
+			                                  ExecuteSQLContext("insert into q (amount,name) VALUES (3,'c')")))
+		var report = EvalDB(context.Background(),db,AndContext(QueryValue(&count,"select count(*) from q"),
+			                                               QueryValue(&row,"select name, amount from q where amount = ?",3)))
+		if !report.Result.Ok() || count != 1 || row.Name != "c" || row.Amount != 3 {
+			t.Errorf("query : expected value got %v %v %v",report.Result,count,row)
+		}
+		report = EvalDB(context.Background(),db,QueryValue(&count,"select amount from q where amount = ?",4))
+		if report.Result.Kind != TestFailed {
+			t.Errorf("query : expected no rows to fail got %v",report.Result)
+		}
+		report = EvalDB(context.Background(),db,QueryValue(&row,"select amount, name, 1 as extra from q"))
+		if report.Result.Kind != Errored || !strings.Contains(report.Result.Err.Error(),"extra") {
+			t.Errorf("query : expected unknown column error got %v",report.Result)
+		}
+	})
+}
+
+func TestQueryEachStops(t *testing.T) {
+	var seen []int
+	var fake = NewFakeExecutor().Answer("select n from n",[]interface{}{1},[]interface{}{2},[]interface{}{3})
+	var handler = func(n int) Result {
+		seen = append(seen,n)
+		if n == 2 {
+			return Failed("two")
+		}
+		return Passed()
+	}
+	var result = QueryEach(handler,"select n from n")(context.Background(),fake)
+	if result.Kind != TestFailed || result.Step != "two" || len(seen) != 2 {
+		t.Errorf("query : expected each to stop at two got %v %v",result,seen)
+	}
+}
+
+func TestQueryFakeRows(t *testing.T) {
+	var rows []queryRow
+	var fake = NewFakeExecutor().Answer("select name, amount from q",[]interface{}{"a",1})
+	if r := QuerySlice(&rows,"select name, amount from q")(context.Background(),fake); !r.Ok() || len(rows) != 1 || rows[0].Amount != 1 {
+		t.Errorf("query : expected fields in declaration order got %v %v",r,rows)
+	}
+	fake.AnswerColumns("select amount, name from q",[]string{"amount","NAME"},[]interface{}{2,"b"})
+	if r := QuerySlice(&rows,"select amount, name from q")(context.Background(),fake); !r.Ok() || len(rows) != 1 || rows[0] != (queryRow{"b",2,0}) {
+		t.Errorf("query : expected fields by column got %v %v",r,rows)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+/* outcome of evaluating an expression */
+type ResultKind int
+
+const (
+	Success ResultKind = iota
+	TestFailed
+	Errored
+	Cancelled
+)
+
+func (kind ResultKind) String() string {
+	switch kind {
+	case Success:
+		return "success"
+	case TestFailed:
+		return "test failed"
+	case Errored:
+		return "error"
+	case Cancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("ResultKind(%d)", int(kind))
+}
+
+/*
+ Step names the expression that decided the outcome, Err is set when
+ Kind is Errored or Cancelled, or when a Triple failed. Attempts counts
+ the runs of a Retry, it is 0 when the outcome was not retried.
+*/
+type Result struct {
+	Kind     ResultKind
+	Step     string
+	Err      error
+	Attempts int
+}
+
+func Passed() Result { return Result{Kind: Success} }
+
+func Failed(step string) Result { return Result{Kind: TestFailed, Step: step} }
+
+func Faulted(step string, err error) Result { return Result{Kind: Errored, Step: step, Err: err} }
+
+func Interrupted(step string, err error) Result { return Result{Kind: Cancelled, Step: step, Err: err} }
+
+func (r Result) Ok() bool { return r.Kind == Success }
+
+func (r Result) String() string {
+	var s string
+	switch r.Kind {
+	case Success:
+		s = r.Kind.String()
+	case Errored, Cancelled:
+		s = fmt.Sprintf("%v in %v: %v", r.Kind, r.Step, r.Err)
+	default:
+		s = fmt.Sprintf("%v in %v", r.Kind, r.Step)
+	}
+	if r.Attempts > 1 {
+		s = fmt.Sprintf("%v after %d attempts", s, r.Attempts)
+	}
+	return s
+}
+
+type KatResultExpression func(Executor) Result
+
+/* adapters to and from the bool form */
+func Lift(op KatExpression) (KatResultExpression) {
+	return func(tx Executor) Result {
+		if op(tx) {
+			return Passed()
+		}
+		return Failed("KatExpression")
+	}
+}
+
+/*
+ errors are logged by the step that failed, the error or cancellation
+ that reaches the bool form is logged again as it is lost there so
+ that the errors of combinators are not dropped
+*/
+func Lower(op KatResultExpression) (KatExpression) {
+	return func(tx Executor) bool {
+		var result = op(tx)
+		logResult(contextOf(tx), "Lower", result)
+		return result.Ok()
+	}
+}
+
+func ZeroResult(Executor) Result { return Failed("Zero") }
+
+func AndResult(args ... KatResultExpression) (KatResultExpression) {
+	return Background(AndContext(contextualAll(args)...))
+}
+
+func OrResult(args ... KatResultExpression) (KatResultExpression) {
+	return Background(OrContext(contextualAll(args)...))
+}
+
+func StarResult(op KatResultExpression) (KatResultExpression) {
+	return Background(StarContext(Contextual(op)))
+}
+
+func NotResult(op KatResultExpression) (KatResultExpression) {
+	return Background(NotContext(Contextual(op)))
+}
+
+var OneResult KatResultExpression = NotResult(ZeroResult)
+
+func EvalResult(driverName string, dataSourceName string, expression KatResultExpression) Result {
+	return EvalContext(context.Background(), driverName, dataSourceName, Contextual(expression))
+}
+
+func ExecuteSQLResult(statement string, args ...interface{}) KatResultExpression {
+	return Background(ExecuteSQLContext(statement, args...))
+}
+
+func ExecuteQueryResult(query string, args ...interface{}) func(...interface{}) KatResultExpression {
+	return func(dest ...interface{}) KatResultExpression {
+		return Background(ExecuteQueryContext(query, args...)(dest...))
+	}
+}
+
+func HandleQueryResult(query string, args ...interface{}) func(Executor, func(), ...interface{}) Result {
+	return func(tx Executor, handler func(), dest ...interface{}) Result {
+		return HandleQueryContext(query, args...)(contextOf(tx), tx, handler, dest...)
+	}
+}
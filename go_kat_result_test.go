@@ -0,0 +1,139 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"errors"
+)
+
+func assertResult(t *testing.T,msg string,expected ResultKind,k KatResultExpression) KatResultExpression {
+	return func(tx Executor) Result {
+		result := k(tx)
+		if result.Kind != expected {
+			t.Errorf("%s : expected %v got %v",msg,expected,result)
+		}
+		return result
+	}
+}
+
+func TestResultLogic(t *testing.T) {
+	assertResult(t,"result : zero",TestFailed,ZeroResult)(nil)
+	assertResult(t,"result : one",Success,OneResult)(nil)
+	assertResult(t,"result : and",Success,AndResult())(nil)
+	assertResult(t,"result : and 1 1",Success,AndResult(OneResult,OneResult))(nil)
+	assertResult(t,"result : and 1 0",TestFailed,AndResult(OneResult,ZeroResult))(nil)
+	assertResult(t,"result : not 0",Success,NotResult(ZeroResult))(nil)
+}
+
+func TestResultNotKeepsError(t *testing.T) {
+	var failing = func(tx Executor) Result { return Faulted("failing",errors.New("boom")) }
+	var result = NotResult(failing)(nil)
+	if result.Kind != Errored || result.Step != "failing" {
+		t.Errorf("not : expected error from failing got %v",result)
+	}
+	if AndResult(OneResult,failing,ZeroResult)(nil).Step != "failing" {
+		t.Errorf("and : expected failing step")
+	}
+}
+
+func TestResultAdapters(t *testing.T) {
+	assertResult(t,"lift : one",Success,Lift(One))(nil)
+	assertResult(t,"lift : zero",TestFailed,Lift(Zero))(nil)
+	if !Lower(OneResult)(nil) || Lower(ZeroResult)(nil) {
+		t.Errorf("lower : expected one and zero")
+	}
+	if !And(Lower(Lift(One)),One)(nil) {
+		t.Errorf("lower lift : expected one")
+	}
+}
+
+func TestExecuteSQLResult(t *testing.T) {
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalResult("sqlite3",tmpfile,ExecuteSQLResult("drop table a"))
+		if result.Kind != Errored || result.Err == nil || result.Step == "" {
+			t.Errorf("execute sql result : expected error got %v",result)
+		}
+		result = EvalResult("sqlite3",tmpfile,ExecuteSQLResult("create table a(a integer)"))
+		if !result.Ok() {
+			t.Errorf("execute sql result : expected success got %v",result)
+		}
+	})
+}
+
+func TestExecuteQueryResult(t *testing.T) {
+	var a = 0
+	WithTestFile(t,func(tmpfile string){
+		EvalResult("sqlite3",tmpfile,AndResult(
+			assertResult(t,"query result : create a",Success,ExecuteSQLResult("create table a(a integer)")),
+			NotResult(assertResult(t,"query result : no rows",TestFailed,ExecuteQueryResult("select a from a")(&a))),
+			assertResult(t,"query result : no table",Errored,ExecuteQueryResult("select b from b")(&a))))
+	})
+}
+
+func TestOrResultTransaction(t *testing.T) {
+	var sum = 0
+	var checkSum = func(expected int) KatResultExpression {
+		return func(tx Executor) Result {
+			var tmp = 0
+			sum = 0
+			var r = HandleQueryResult("select b from b")(tx,func(){ sum += tmp },&tmp)
+			if r.Ok() && sum != expected {
+				return Failed("checkSum")
+			}
+			return r
+		}
+	}
+	var createTable = AndResult(ExecuteSQLResult("drop table if exists b"),ExecuteSQLResult("create table b (b integer)"))
+	var insertOne = ExecuteSQLResult("insert into b (b) VALUES (1)")
+	var insertTwo = ExecuteSQLResult("insert into b (b) VALUES (2)")
+	var broken = ExecuteSQLResult("insert into c (c) VALUES (1)")
+	WithTestFile(t,func(tmpfile string){
+		var result = EvalResult("sqlite3",tmpfile,AndResult(createTable,
+			assertResult(t,"or result : 0 +One",Success,OrResult(AndResult(insertTwo,ZeroResult),insertOne)),
+			assertResult(t,"or result : sum 1",Success,checkSum(1))))
+		if !result.Ok() {
+			t.Errorf("or result : expected commit got %v",result)
+		}
+		result = EvalResult("sqlite3",tmpfile,AndResult(
+			assertResult(t,"or result : error",Errored,OrResult(AndResult(insertTwo,broken))),
+			checkSum(1)))
+		if result.Kind != Errored || result.Err == nil {
+			t.Errorf("or result : expected error got %v",result)
+		}
+		EvalResult("sqlite3",tmpfile,assertResult(t,"or result : rolled back",Success,checkSum(1)))
+	})
+}
+
+func TestStarResult(t *testing.T) {
+	var count = 0
+	var insertn = func(expected int,last KatResultExpression) KatResultExpression {
+		return func(tx Executor) Result {
+			count = count + 1
+			if count <= expected {
+				return ExecuteSQLResult("insert into s (s) VALUES (1)")(tx)
+			}
+			return last(tx)
+		}
+	}
+	var total = 0
+	var countRows = ExecuteQueryResult("select count(*) from s")(&total)
+	var createTable = AndResult(ExecuteSQLResult("drop table if exists s"),ExecuteSQLResult("create table s (s integer)"))
+	var broken = AndResult(ExecuteSQLResult("insert into s (s) VALUES (1)"),ExecuteSQLResult("insert into t (t) VALUES (1)"))
+	WithTestFile(t,func(tmpfile string){
+		EvalResult("sqlite3",tmpfile,AndResult(createTable,
+			assertResult(t,"star result : 3",Success,StarResult(insertn(3,ZeroResult))),
+			countRows))
+		if total != 3 {
+			t.Errorf("star result : expected 3 rows got %v",total)
+		}
+		count = 0
+		var result = EvalResult("sqlite3",tmpfile,StarResult(insertn(2,broken)))
+		if result.Kind != Errored {
+			t.Errorf("star result : expected error got %v",result)
+		}
+		EvalResult("sqlite3",tmpfile,countRows)
+		if total != 3 {
+			t.Errorf("star result : expected rollback to 3 rows got %v",total)
+		}
+	})
+}
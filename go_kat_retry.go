@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+/*
+ retrying transient failures : a busy or locked SQLite database, a
+ serialization failure or deadlock in Postgres or MySQL. Retry reruns
+ an expression in a fresh savepoint, WithRetry makes EvalDB rerun the
+ whole transaction.
+*/
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Transient   func(error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}
+
+/* serialization failure and deadlock */
+var transientStates = []string{"40001", "40P01"}
+
+/* messages of drivers whose error types are not imported here */
+var transientMessages = []string{"database is locked", "database table is locked", "deadlock found", "lock wait timeout exceeded"}
+
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		for _, state := range transientStates {
+			if stateErr.SQLState() == state {
+				return true
+			}
+		}
+		return false
+	}
+	var message = strings.ToLower(err.Error())
+	for _, transient := range transientMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+/* whether an attempt that failed with err is followed by another */
+func (policy RetryPolicy) retries(attempt int, err error) bool {
+	var transient = policy.Transient
+	if transient == nil {
+		transient = IsTransient
+	}
+	return attempt < policy.MaxAttempts && transient(err)
+}
+
+/* sleeps the doubling backoff of attempt unless ctx is done first */
+func (policy RetryPolicy) wait(ctx context.Context, attempt int) error {
+	var backoff = policy.Backoff << (attempt - 1)
+	if policy.MaxBackoff > 0 && (backoff > policy.MaxBackoff || backoff <= 0) {
+		backoff = policy.MaxBackoff
+	}
+	var timer = time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type retryKey struct{}
+
+/* EvalDB reruns the transaction when it fails with a transient error */
+func WithRetry(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryKey{}, policy)
+}
+
+func RetryContext(policy RetryPolicy, op KatContextExpression) (KatContextExpression) {
+	return traced("Retry", func(ctx context.Context, tx Executor) Result {
+		for attempt := 1; ; attempt++ {
+			var result = inSavepoint(ctx, tx, op)
+			result.Attempts = attempt
+			if result.Kind != Errored || !policy.retries(attempt, result.Err) {
+				return result
+			}
+			if err := policy.wait(ctx, attempt); err != nil {
+				var interrupted = Interrupted("Retry", err)
+				interrupted.Attempts = attempt
+				return interrupted
+			}
+		}
+	})
+}
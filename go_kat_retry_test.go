@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"database/sql"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+type stateError string
+
+func (err stateError) Error() string { return "state " + string(err) }
+
+func (err stateError) SQLState() string { return string(err) }
+
+func TestIsTransient(t *testing.T) {
+	var transient = []error{sqlite3.Error{Code: sqlite3.ErrBusy},
+		                fmt.Errorf("Commit: %w",sqlite3.Error{Code: sqlite3.ErrLocked}),
+		                stateError("40001"),
+		                errors.New("Error 1213: Deadlock found when trying to get lock")}
+	for _, err := range transient {
+		if !IsTransient(err) {
+			t.Errorf("retry : expected %v to be transient",err)
+		}
+	}
+	var permanent = []error{nil,
+		                sqlite3.Error{Code: sqlite3.ErrConstraint},
+		                stateError("23505"),
+		                errors.New("no such table: a"),
+		                context.Canceled}
+	for _, err := range permanent {
+		if IsTransient(err) {
+			t.Errorf("retry : expected %v not to be transient",err)
+		}
+	}
+}
+
+/* fails with a busy database the first failures times it runs */
+func busyFor(failures int,count *int) KatContextExpression {
+	return func(ctx context.Context,tx Executor) Result {
+		*count = *count + 1
+		if *count <= failures {
+			return Faulted("busy",sqlite3.Error{Code: sqlite3.ErrBusy})
+		}
+		return Passed()
+	}
+}
+
+func TestRetryExpression(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var count = 0
+	var r = RetryContext(testRetryPolicy,busyFor(2,&count))(context.Background(),fake)
+	if !r.Ok() || r.Attempts != 3 || count != 3 {
+		t.Errorf("retry : expected success on the third attempt got %v %v",r,count)
+	}
+	count = 0
+	r = RetryContext(testRetryPolicy,busyFor(5,&count))(context.Background(),fake)
+	if r.Kind != Errored || r.Attempts != 3 || count != 3 {
+		t.Errorf("retry : expected to give up after three attempts got %v %v",r,count)
+	}
+	count = 0
+	r = RetryContext(testRetryPolicy,counted(&count,Failed("test")))(context.Background(),fake)
+	if r.Kind != TestFailed || r.Attempts != 1 || count != 1 {
+		t.Errorf("retry : expected a failed test not to be retried got %v %v",r,count)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var count = 0
+	var policy = RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+	var r = RetryContext(policy,busyFor(5,&count))(ctx,NewFakeExecutor())
+	if r.Kind != Cancelled || count != 1 {
+		t.Errorf("retry : expected the backoff to be cancelled got %v %v",r,count)
+	}
+}
+
+func TestRetryEval(t *testing.T) {
+	var count = 0
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(WithRetry(context.Background(),testRetryPolicy),db,busyFor(1,&count))
+		if !report.Committed || report.Attempts != 2 {
+			t.Errorf("retry : expected the transaction to commit on the second attempt got %v",report)
+		}
+		count = 0
+		report = EvalDB(context.Background(),db,busyFor(1,&count))
+		if report.Committed || report.Attempts != 1 {
+			t.Errorf("retry : expected no retry without a policy got %v",report)
+		}
+	})
+}
+
+func TestRetryLockedDatabase(t *testing.T) {
+	WithTestFile(t,func(tmpfile string){
+		holder, err := sql.Open("sqlite3",tmpfile)
+		if err != nil {
+			t.Fatalf("could not open %v",tmpfile)
+		}
+		defer holder.Close()
+		waiter, err := sql.Open("sqlite3",tmpfile+"?_busy_timeout=0")
+		if err != nil {
+			t.Fatalf("could not open %v",tmpfile)
+		}
+		defer waiter.Close()
+		EvalDB(context.Background(),holder,ExecuteSQLContext("create table l (l integer)"))
+		tx, err := holder.Begin()
+		if err != nil {
+			t.Fatalf("could not begin %v",err)
+		}
+		tx.Exec("insert into l (l) VALUES (1)")
+		time.AfterFunc(20 * time.Millisecond,func(){ tx.Commit() })
+		var policy = RetryPolicy{MaxAttempts: 50, Backoff: 5 * time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+		var report = EvalDB(WithRetry(context.Background(),policy),waiter,ExecuteSQLContext("insert into l (l) VALUES (2)"))
+		if !report.Committed || report.Attempts < 2 {
+			t.Errorf("retry : expected the insert to wait for the lock got %v",report)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"github.com/rs/xid"
+)
+
+/*
+ a savepoint opened by a combinator. Every savepoint is released
+ before the combinator returns so nested loops do not accumulate
+ open savepoints, a failed branch is rolled back before it is
+ released so it leaves no side effects.
+*/
+type Savepoint struct {
+	Name string
+	tx   Executor
+}
+
+func BeginSavepoint(ctx context.Context, tx Executor) (*Savepoint, Result) {
+	var savepoint = &Savepoint{Name: "kat_" + xid.New().String(), tx: tx}
+	return savepoint, savepoint.exec(ctx, "savepoint", tx.Savepoint, false)
+}
+
+/* undoes everything since the savepoint, the savepoint stays open */
+func (savepoint *Savepoint) RollbackTo(ctx context.Context) Result {
+	return savepoint.exec(ctx, "rollback to savepoint", savepoint.tx.RollbackTo, true)
+}
+
+func (savepoint *Savepoint) Release(ctx context.Context) Result {
+	return savepoint.exec(ctx, "release savepoint", savepoint.tx.Release, false)
+}
+
+/* rolls back and releases */
+func (savepoint *Savepoint) Discard(ctx context.Context) Result {
+	if r := savepoint.RollbackTo(ctx); !r.Ok() {
+		return r
+	}
+	return savepoint.Release(ctx)
+}
+
+/* runs op in a savepoint that is released when it succeeds and discarded otherwise */
+func inSavepoint(ctx context.Context, tx Executor, op KatContextExpression) Result {
+	savepoint, r := BeginSavepoint(ctx, tx)
+	if !r.Ok() {
+		return r
+	}
+	var result = op(ctx, tx)
+	if result.Ok() {
+		r = savepoint.Release(ctx)
+	} else if result.Kind != Cancelled {
+		r = savepoint.Discard(ctx)
+	}
+	if !r.Ok() {
+		return r
+	}
+	return result
+}
+
+func (savepoint *Savepoint) exec(ctx context.Context, verb string, op func(context.Context, string) error, rollback bool) Result {
+	var statement = verb + " " + savepoint.Name
+	ctx = WithLogger(ctx, LoggerOf(ctx).With(slog.String("savepoint", savepoint.Name)))
+	return traceStep(ctx, verb, []interface{}{statement}, func() Result {
+		if err := op(ctx, savepoint.Name); err != nil {
+			return contextFault(ctx, statement, err)
+		}
+		traceSavepoint(ctx, savepoint.Name, rollback)
+		return Passed()
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"strings"
+	"database/sql"
+)
+
+func countRows(table string,expected int) KatExpression {
+	return func(tx Executor) bool {
+		var count = -1
+		return ExecuteQuery("select count(*) from " + table)(&count)(tx) && count == expected
+	}
+}
+
+func atMostRows(table string,limit int) KatExpression {
+	return func(tx Executor) bool {
+		var count = -1
+		return ExecuteQuery("select count(*) from " + table)(&count)(tx) && count <= limit
+	}
+}
+
+func TestStarRollsBackLastIteration(t *testing.T) {
+	var createTable = ExecuteSQL("create table s (s integer)")
+	var insertUpToThree = And(ExecuteSQL("insert into s (s) VALUES (1)"),atMostRows("s",3))
+	WithTestExpression(t,assertExpression(t,"savepoint : star keeps 3 rows",
+		And(createTable,Star(insertUpToThree),countRows("s",3))))
+}
+
+func TestOrFailedBranchHasNoEffect(t *testing.T) {
+	var createTable = ExecuteSQL("create table o (o integer)")
+	var insertThenFail = And(ExecuteSQL("insert into o (o) VALUES (1)"),Zero)
+	WithTestExpression(t,assertExpression(t,"savepoint : failed or",
+		And(createTable,Not(Or(insertThenFail,insertThenFail)),countRows("o",0))))
+	WithTestExpression(t,assertExpression(t,"savepoint : or second branch",
+		And(createTable,Or(insertThenFail,ExecuteSQL("insert into o (o) VALUES (2)")),countRows("o",1))))
+}
+
+func TestSavepointsAreReleased(t *testing.T) {
+	var insertUpToFifty = AndContext(ExecuteSQLContext("insert into s (s) VALUES (1)"),LiftContext(atMostRows("s",50)))
+	var ensure = OrContext(LiftContext(countRows("s",0)),ZeroContext)
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table s (s integer)"),
+			                                               StarContext(AndContext(insertUpToFifty,NotContext(ensure)))))
+		if !report.Committed {
+			t.Fatalf("savepoint : expected commit got %v",report)
+		}
+		var open = map[string]int{}
+		for _, step := range report.Steps {
+			var fields = strings.Fields(step.Args[0].(string))
+			switch fields[0] {
+			case "savepoint":
+				open[fields[1]]++
+			case "release":
+				open[fields[2]]--
+			}
+		}
+		if len(open) < 100 {
+			t.Errorf("savepoint : expected a savepoint per iteration and or got %v",len(open))
+		}
+		for name, count := range open {
+			if count != 0 {
+				t.Errorf("savepoint : %v not released",name)
+			}
+		}
+	})
+}
+
+func TestSavepointErrors(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("savepoint : could not begin %v",err)
+		}
+		defer tx.Rollback()
+		var executor = NewTxExecutor(tx,SQLiteDialect{})
+		var missing = &Savepoint{Name: "kat_missing", tx: executor}
+		if r := missing.Release(context.Background()); r.Kind != Errored || r.Err == nil {
+			t.Errorf("savepoint : expected release error got %v",r)
+		}
+		savepoint, r := BeginSavepoint(context.Background(),executor)
+		if !r.Ok() || !strings.HasPrefix(savepoint.Name,"kat_") {
+			t.Errorf("savepoint : expected savepoint got %v %v",savepoint.Name,r)
+		}
+		if r := savepoint.Discard(context.Background()); !r.Ok() {
+			t.Errorf("savepoint : expected discard got %v",r)
+		}
+		if r := savepoint.Release(context.Background()); r.Kind != Errored {
+			t.Errorf("savepoint : expected discarded savepoint to be gone got %v",r)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+ rewrites following the identities in the README. Or is an ordered
+ choice that rolls back a failed branch, so only the laws that hold
+ for that reading are used :
+
+   0 + p = p        1 + p = 1        p + p = p
+   1 * p = p        0 * p = 0        p p⃰ + 1 = p⃰
+   !!p = p          !0 = 1           !1 = 0          0⃰ = 1
+
+ and for a read-only p, where evaluating it twice or not at all
+ changes nothing :
+
+   p p = p          p !p = 0         p + !p = 1
+   p (q + r) = p q + p r             (only with Distribute)
+
+ p q + p r rolls back the writes of p when both branches fail and
+ p (q + r) does not, so a prefix that writes is not distributed.
+
+ a choice of one branch is kept unless the branch is read-only, it
+ rolls back the effects of p when p fails and p alone does not.
+*/
+type SimplifyOptions struct {
+	Distribute bool
+}
+
+type Rewrite struct {
+	Rule   string
+	Before Expr
+	After  Expr
+}
+
+func (r Rewrite) String() string {
+	return fmt.Sprintf("%v : %v => %v", r.Rule, r.Before, r.After)
+}
+
+type simplifier struct {
+	options  SimplifyOptions
+	rewrites []Rewrite
+}
+
+func Simplify(e Expr, options SimplifyOptions) (Expr, []Rewrite) {
+	var s = &simplifier{options: options}
+	return s.expr(e), s.rewrites
+}
+
+func (s *simplifier) expr(e Expr) Expr {
+	switch node := e.(type) {
+	case AndNode:
+		e = AndNode{s.all(node.Args)}
+	case OrNode:
+		e = OrNode{s.all(node.Args)}
+	case NotNode:
+		e = NotNode{s.expr(node.Arg)}
+	case StarNode:
+		e = StarNode{s.expr(node.Arg)}
+	}
+	if next, rule, ok := s.step(e); ok {
+		s.rewrites = append(s.rewrites, Rewrite{rule, e, next})
+		return s.expr(next)
+	}
+	return e
+}
+
+func (s *simplifier) all(args []Expr) []Expr {
+	var result = make([]Expr, len(args))
+	for i, arg := range args {
+		result[i] = s.expr(arg)
+	}
+	return result
+}
+
+func (s *simplifier) step(e Expr) (Expr, string, bool) {
+	switch node := e.(type) {
+	case AndNode:
+		return s.and(node.Args)
+	case OrNode:
+		return s.or(node.Args)
+	case NotNode:
+		switch arg := node.Arg.(type) {
+		case NotNode:
+			return arg.Arg, "!!p = p", true
+		case ZeroNode:
+			return OneExpr, "!0 = 1", true
+		case OneNode:
+			return ZeroExpr, "!1 = 0", true
+		}
+	case StarNode:
+		if _, ok := node.Arg.(ZeroNode); ok {
+			return OneExpr, "0" + StarSymbol + " = 1", true
+		}
+	}
+	return e, "", false
+}
+
+func (s *simplifier) and(args []Expr) (Expr, string, bool) {
+	if len(args) == 0 {
+		return OneExpr, "empty * = 1", true
+	}
+	if flat, ok := flatten(args, func(e Expr) ([]Expr, bool) { node, ok := e.(AndNode); return node.Args, ok }); ok {
+		return AndNode{flat}, "associativity of *", true
+	}
+	if rest, ok := without(args, OneNode{}); ok {
+		return AndNode{rest}, "1 * p = p", true
+	}
+	for i, arg := range args[:len(args)-1] {
+		if _, ok := arg.(ZeroNode); ok {
+			return AndNode{args[:i+1]}, "0 * p = 0", true
+		}
+	}
+	for i := 0; i+1 < len(args); i++ {
+		if EffectOf(args[i]) != ReadOnly {
+			continue
+		}
+		if Equal(args[i], args[i+1]) {
+			return AndNode{replace(args, i, 2, args[i])}, "p p = p", true
+		}
+		if complements(args[i], args[i+1]) {
+			return AndNode{replace(args, i, 2, ZeroExpr)}, "p !p = 0", true
+		}
+	}
+	if len(args) == 1 {
+		return args[0], "unary *", true
+	}
+	if or, ok := args[len(args)-1].(OrNode); ok && s.options.Distribute && len(or.Args) > 1 {
+		var prefix = args[:len(args)-1]
+		if EffectOf(AndNode{prefix}) != ReadOnly {
+			return AndNode{args}, "", false
+		}
+		var branches = make([]Expr, len(or.Args))
+		for i, branch := range or.Args {
+			branches[i] = AndNode{append(append([]Expr{}, prefix...), branch)}
+		}
+		return OrNode{branches}, "p (q + r) = p q + p r", true
+	}
+	return AndNode{args}, "", false
+}
+
+func (s *simplifier) or(args []Expr) (Expr, string, bool) {
+	if len(args) == 0 {
+		return OneExpr, "empty + = 1", true
+	}
+	if flat, ok := flatten(args, func(e Expr) ([]Expr, bool) { node, ok := e.(OrNode); return node.Args, ok }); ok {
+		return OrNode{flat}, "associativity of +", true
+	}
+	if rest, ok := without(args, ZeroNode{}); ok {
+		if len(rest) == 0 {
+			return ZeroExpr, "0 + p = p", true
+		}
+		return OrNode{rest}, "0 + p = p", true
+	}
+	for i, arg := range args[:len(args)-1] {
+		if _, ok := arg.(OneNode); ok {
+			return OrNode{args[:i+1]}, "1 + p = 1", true
+		}
+	}
+	for i := 0; i+1 < len(args); i++ {
+		if complements(args[i], args[i+1]) {
+			return OrNode{replace(args, i, 2, OneExpr)}, "p + !p = 1", true
+		}
+	}
+	for i := range args {
+		for j := i + 1; j < len(args); j++ {
+			if Equal(args[i], args[j]) {
+				var rest = append(append([]Expr{}, args[:j]...), args[j+1:]...)
+				return OrNode{rest}, "p + p = p", true
+			}
+		}
+	}
+	if len(args) == 1 && EffectOf(args[0]) == ReadOnly {
+		return args[0], "unary +", true
+	}
+	if len(args) == 2 {
+		if _, ok := args[1].(OneNode); ok {
+			if star, ok := unfolded(args[0]); ok {
+				return star, "p p" + StarSymbol + " + 1 = p" + StarSymbol, true
+			}
+		}
+	}
+	return OrNode{args}, "", false
+}
+
+/* recognises p p⃰ where p may itself be a flattened sequence */
+func unfolded(e Expr) (Expr, bool) {
+	and, ok := e.(AndNode)
+	if !ok || len(and.Args) < 2 {
+		return nil, false
+	}
+	star, ok := and.Args[len(and.Args)-1].(StarNode)
+	if !ok {
+		return nil, false
+	}
+	var prefix = and.Args[:len(and.Args)-1]
+	if len(prefix) == 1 && Equal(prefix[0], star.Arg) {
+		return star, true
+	}
+	return star, Equal(AndNode{prefix}, star.Arg)
+}
+
+/* p and !p for a read-only leaf p, only leaves as a read-only star may diverge */
+func complements(a Expr, b Expr) bool {
+	var leaf, negated = a, b
+	if not, ok := a.(NotNode); ok {
+		leaf, negated = b, not
+	}
+	not, ok := negated.(NotNode)
+	if !ok {
+		return false
+	}
+	node, ok := leaf.(LeafNode)
+	return ok && node.Effect == ReadOnly && Equal(node, not.Arg)
+}
+
+/* args with the n args from i replaced by e */
+func replace(args []Expr, i int, n int, e Expr) []Expr {
+	return append(append(append([]Expr{}, args[:i]...), e), args[i+n:]...)
+}
+
+func flatten(args []Expr, children func(Expr) ([]Expr, bool)) ([]Expr, bool) {
+	var result []Expr
+	var changed = false
+	for _, arg := range args {
+		if nested, ok := children(arg); ok {
+			result = append(result, nested...)
+			changed = true
+		} else {
+			result = append(result, arg)
+		}
+	}
+	return result, changed
+}
+
+func without(args []Expr, unit Expr) ([]Expr, bool) {
+	var result []Expr
+	var changed = false
+	for _, arg := range args {
+		if Equal(arg, unit) {
+			changed = true
+		} else {
+			result = append(result, arg)
+		}
+	}
+	return result, changed
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"database/sql"
+)
+
+func TestSimplifyIdentities(t *testing.T) {
+	var p = Leaf("p",One)
+	var q = Leaf("q",Zero)
+	var r = Leaf("r",One)
+	var star = StarExpr(p)
+	var cases = []struct {
+		before Expr
+		after  Expr
+		rule   string
+	}{
+		{OrExpr(ZeroExpr,p),OrExpr(p),"0 + p = p"},
+		{OrExpr(ZeroExpr,ZeroExpr),ZeroExpr,"0 + p = p"},
+		{OrExpr(p,p),OrExpr(p),"p + p = p"},
+		{OrExpr(p,q,p),OrExpr(p,q),"p + p = p"},
+		{AndExpr(OneExpr,p),p,"1 * p = p"},
+		{AndExpr(ZeroExpr,p),ZeroExpr,"0 * p = 0"},
+		{OrExpr(OneExpr,p),OneExpr,"1 + p = 1"},
+		{AndExpr(p,AndExpr(q,r)),AndExpr(p,q,r),"associativity of *"},
+		{OrExpr(OrExpr(p,q),r),OrExpr(p,q,r),"associativity of +"},
+		{NotExpr(NotExpr(p)),p,"!!p = p"},
+		{NotExpr(ZeroExpr),OneExpr,"!0 = 1"},
+		{StarExpr(ZeroExpr),OneExpr,"0" + StarSymbol + " = 1"},
+		{OrExpr(AndExpr(p,star),OneExpr),star,"p p" + StarSymbol + " + 1 = p" + StarSymbol},
+		{OrExpr(AndExpr(p,q,StarExpr(AndExpr(p,q))),OneExpr),StarExpr(AndExpr(p,q)),"p p" + StarSymbol + " + 1 = p" + StarSymbol},
+	}
+	for _, c := range cases {
+		after, rewrites := Simplify(c.before,SimplifyOptions{})
+		if !Equal(after,c.after) {
+			t.Errorf("simplify %v : expected %v got %v",c.before,c.after,after)
+		}
+		var fired = false
+		for _, rewrite := range rewrites {
+			fired = fired || rewrite.Rule == c.rule
+		}
+		if !fired {
+			t.Errorf("simplify %v : expected rule %v in %v",c.before,c.rule,rewrites)
+		}
+	}
+}
+
+func TestSimplifyKeepsOrderedChoice(t *testing.T) {
+	var p = Leaf("p",One)
+	var q = Leaf("q",Zero)
+	var cases = []Expr{
+		AndExpr(p,ZeroExpr),
+		OrExpr(p,OneExpr),
+		OrExpr(AndExpr(p,q),AndExpr(q,p)),
+		AndExpr(OrExpr(p,q),p),
+	}
+	for _, e := range cases {
+		if after, rewrites := Simplify(e,SimplifyOptions{}); !Equal(after,e) || len(rewrites) != 0 {
+			t.Errorf("simplify %v : expected no rewrite got %v %v",e,after,rewrites)
+		}
+	}
+}
+
+func TestSimplifyDistribute(t *testing.T) {
+	var p = ReadOnlyLeaf("p",One)
+	var q = Leaf("q",Zero)
+	var r = Leaf("r",One)
+	var e = AndExpr(p,OrExpr(q,r))
+	if after, _ := Simplify(e,SimplifyOptions{}); !Equal(after,e) {
+		t.Errorf("simplify : distribution not requested got %v",after)
+	}
+	var after, rewrites = Simplify(e,SimplifyOptions{Distribute: true})
+	if !Equal(after,OrExpr(AndExpr(p,q),AndExpr(p,r))) || len(rewrites) != 1 {
+		t.Errorf("simplify : expected p q + p r got %v %v",after,rewrites)
+	}
+	var writes = AndExpr(Leaf("c",One),OrExpr(q,r))
+	if after, _ := Simplify(writes,SimplifyOptions{Distribute: true}); !Equal(after,writes) {
+		t.Errorf("simplify : expected a prefix that writes kept got %v",after)
+	}
+}
+
+func TestSimplifyProcessEntry(t *testing.T) {
+	var e = ProcessEntryExpr(4,Entry{1, 2, 10})
+	var after, rewrites = Simplify(AndExpr(OneExpr,e),SimplifyOptions{})
+	var expected = "batchExists(4) * deleteBatch(4) * !batchExists(4)" +
+		" * ((senderExists(1) + createSender(1))" +
+		" * (recieverExists(2) + createReciever(2))" +
+		" * positiveTransfer(10) * senderExists(1) * recieverExists(2)" +
+		" * saveTransaction(1, 2, 10) * senderPositiveBalance(1) * receiverPositiveBalance(2)" +
+		" + quarantineTransaction(1, 2, 10))"
+	if after.String() != expected {
+		t.Errorf("simplify : expected %v got %v",expected,after)
+	}
+	if len(rewrites) != 4 {
+		t.Errorf("simplify : expected 4 rewrites got %v",rewrites)
+	}
+}
+
+func TestSimplifyReadOnly(t *testing.T) {
+	var p = ReadOnlyLeaf("p",One)
+	var c = Leaf("c",One)
+	var cases = []struct {
+		before Expr
+		after  Expr
+		rule   string
+	}{
+		{AndExpr(c,p,p),AndExpr(c,p),"p p = p"},
+		{AndExpr(p,NotExpr(p),c),ZeroExpr,"p !p = 0"},
+		{AndExpr(c,NotExpr(p),p),AndExpr(c,ZeroExpr),"p !p = 0"},
+		{OrExpr(c,p,NotExpr(p),c),OrExpr(c,OneExpr),"p + !p = 1"},
+	}
+	for _, test := range cases {
+		after, rewrites := Simplify(test.before,SimplifyOptions{})
+		if !Equal(after,test.after) || len(rewrites) == 0 || rewrites[0].Rule != test.rule {
+			t.Errorf("simplify %v : expected %v by %v got %v %v",test.before,test.after,test.rule,after,rewrites)
+		}
+	}
+	for _, e := range []Expr{AndExpr(c,c),AndExpr(c,NotExpr(c)),OrExpr(c,NotExpr(c))} {
+		if after, rewrites := Simplify(e,SimplifyOptions{}); !Equal(after,e) || len(rewrites) != 0 {
+			t.Errorf("simplify %v : mutating expected no rewrite got %v %v",e,after,rewrites)
+		}
+	}
+}
+
+/* the result and the rows left in u after evaluating e on a new table */
+func simplifyState(t *testing.T,e Expr) (ResultKind,int) {
+	var kind ResultKind
+	var rows = -1
+	WithTestDB(t,func(db *sql.DB){
+		var create = ExecuteSQLContext("create table u (u integer)")
+		var report = EvalDB(context.Background(),db,AndContext(create,func(ctx context.Context,tx Executor) Result {
+			kind = e.Compile()(ctx,tx).Kind
+			return QueryValue(&rows,"select count(*) from u")(ctx,tx)
+		}))
+		if report.Err != nil {
+			t.Errorf("simplify : %v evaluation failed %v",e,report)
+		}
+	})
+	return kind, rows
+}
+
+func TestSimplifyKeepsState(t *testing.T) {
+	var ins = Leaf("ins",ExecuteSQL("insert into u (u) VALUES (1)"))
+	var p = ReadOnlyLeaf("p",Zero)
+	var cases = []Expr{
+		NotExpr(OrExpr(AndExpr(ins,ZeroExpr))),
+		NotExpr(OrExpr(ZeroExpr,AndExpr(ins,ZeroExpr))),
+		AndExpr(OrExpr(AndExpr(ins,p)),OneExpr),
+		OrExpr(AndExpr(ins,ins,ZeroExpr),OneExpr),
+		NotExpr(OrExpr(p)),
+		NotExpr(AndExpr(ins,OrExpr(p,ZeroExpr,AndExpr(ins,p)))),
+	}
+	for _, e := range cases {
+		var after, rewrites = Simplify(e,SimplifyOptions{Distribute: true})
+		beforeKind, beforeRows := simplifyState(t,e)
+		afterKind, afterRows := simplifyState(t,after)
+		if beforeKind != afterKind || beforeRows != afterRows {
+			t.Errorf("simplify %v : %v left %v rows with %v, %v left %v rows with %v",e,e,beforeRows,beforeKind,after,afterRows,afterKind)
+			t.Log(rewrites)
+		}
+	}
+	if after, _ := Simplify(NotExpr(OrExpr(p)),SimplifyOptions{}); !Equal(after,NotExpr(p)) {
+		t.Errorf("simplify : expected a read-only unary choice dropped got %v",after)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/* returned when an iteration succeeded without changing the progress measure */
+var ErrNoProgress = errors.New("no progress")
+
+/* the max of a star without a bound */
+const unbounded = -1
+
+/*
+ iterates op, every iteration in its own savepoint, until it fails or
+ max iterations succeeded, max unbounded is no bound. When measure is given it
+ is read before the first and after every successful iteration, an
+ iteration that leaves it unchanged stops the loop with ErrNoProgress.
+ A read-only guard starts every iteration outside the savepoint, when
+ it fails there is nothing to roll back. Either guard or op may be nil.
+*/
+func starLoop(name string, guard KatContextExpression, op KatContextExpression, max int, measure func(context.Context, Executor) (int64, Result)) KatContextExpression {
+	return traced(name, func(ctx context.Context, tx Executor) Result {
+		var before int64
+		if measure != nil {
+			var r Result
+			if before, r = measure(ctx, tx); !r.Ok() {
+				return r
+			}
+		}
+		for iteration := 1; max == unbounded || iteration <= max; iteration++ {
+			if err := ctx.Err(); err != nil {
+				return Interrupted(name, err)
+			}
+			if guard != nil {
+				var result = guard(ctx, tx)
+				if result.Kind == TestFailed {
+					return Passed()
+				} else if !result.Ok() {
+					return result
+				}
+			}
+			if op != nil {
+				savepoint, r := BeginSavepoint(ctx, tx)
+				if !r.Ok() {
+					return r
+				}
+				var result = op(ctx, tx)
+				if result.Kind == Cancelled {
+					return result
+				} else if !result.Ok() {
+					if r := savepoint.Discard(ctx); !r.Ok() {
+						return r
+					}
+					if result.Kind == Errored {
+						return result
+					}
+					return Passed()
+				}
+				if r := savepoint.Release(ctx); !r.Ok() {
+					return r
+				}
+			}
+			if measure != nil {
+				after, r := measure(ctx, tx)
+				if !r.Ok() {
+					return r
+				} else if after == before {
+					return Faulted(name, fmt.Errorf("%w: iteration %d left the measure at %d", ErrNoProgress, iteration, after))
+				}
+				before = after
+			}
+		}
+		return Passed()
+	})
+}
+
+/* op⃰ stopping after at most max iterations, StarN(0, op) is 1 and a negative max an error */
+func StarNContext(max int, op KatContextExpression) (KatContextExpression) {
+	var name = fmt.Sprintf("Star%d", max)
+	if max < 0 {
+		return func(ctx context.Context, tx Executor) Result {
+			return Faulted(name, fmt.Errorf("negative bound %d", max))
+		}
+	}
+	return starLoop(name, nil, op, max, nil)
+}
+
+/* op op⃰ : op must succeed at least once */
+func PlusContext(op KatContextExpression) (KatContextExpression) {
+	return AndContext(op, StarContext(op))
+}
+
+/* op⃰ that aborts when an iteration does not change the value of the measure query */
+func StarProgressContext(op KatContextExpression, measure string, args ...interface{}) (KatContextExpression) {
+	var read = func(ctx context.Context, tx Executor) (int64, Result) {
+		var value int64
+		var r = QueryValue(&value, measure, args...)(ctx, tx)
+		return value, r
+	}
+	return starLoop("Star", nil, op, unbounded, read)
+}
+
+func StarN(max int, op KatExpression) (KatExpression) {
+	return LowerContext(StarNContext(max, LiftContext(op)))
+}
+
+func Plus(op KatExpression) (KatExpression) {
+	return LowerContext(PlusContext(LiftContext(op)))
+}
+
+func StarProgress(op KatExpression, measure string, args ...interface{}) (KatExpression) {
+	return LowerContext(StarProgressContext(LiftContext(op), measure, args...))
+}
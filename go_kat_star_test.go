@@ -0,0 +1,119 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"strings"
+	"database/sql"
+	"log/slog"
+)
+
+func TestStarN(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var count = 0
+	if r := StarNContext(3,counted(&count,Passed()))(context.Background(),fake); !r.Ok() || count != 3 {
+		t.Errorf("star n : expected three iterations got %v %v",r,count)
+	}
+	count = 0
+	if r := StarNContext(3,counted(&count,Failed("stop")))(context.Background(),fake); !r.Ok() || count != 1 {
+		t.Errorf("star n : expected to stop on failure got %v %v",r,count)
+	}
+	if !StarN(2,One)(fake) {
+		t.Errorf("star n : expected bool form to hold")
+	}
+}
+
+func TestStarNZero(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var count = 0
+	if r := StarNContext(0,counted(&count,Passed()))(context.Background(),fake); !r.Ok() || count != 0 || len(fake.Queries()) != 0 {
+		t.Errorf("star n : expected no iteration got %v %v %v",r,count,fake.Queries())
+	}
+	if r := StarNContext(-1,counted(&count,Passed()))(context.Background(),fake); r.Kind != Errored || count != 0 {
+		t.Errorf("star n : expected a negative bound to be an error got %v %v",r,count)
+	}
+}
+
+func TestPlus(t *testing.T) {
+	var fake = NewFakeExecutor()
+	if Plus(Zero)(fake) {
+		t.Errorf("plus : expected zero to fail")
+	}
+	var count = 0
+	var twice = func(ctx context.Context,tx Executor) Result {
+		count = count + 1
+		if count > 2 {
+			return Failed("twice")
+		}
+		return Passed()
+	}
+	if r := PlusContext(twice)(context.Background(),fake); !r.Ok() || count != 3 {
+		t.Errorf("plus : expected two iterations got %v %v",r,count)
+	}
+}
+
+func TestStarProgress(t *testing.T) {
+	var total = -1
+	var insert = ExecuteSQLContext("insert into p (p) VALUES (1)")
+	var delete = ExecuteSQLContext("delete from p where rowid = (select min(rowid) from p)")
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table p (p integer)"),insert,insert,insert))
+		var report = EvalDB(context.Background(),db,StarProgressContext(AndContext(QueryValue(&total,"select p from p limit 1"),delete),
+			                                                         "select count(*) from p"))
+		if !report.Committed {
+			t.Errorf("star progress : expected to drain p got %v",report)
+		}
+		EvalDB(context.Background(),db,insert)
+		report = EvalDB(context.Background(),db,StarProgressContext(OneContext,"select count(*) from p"))
+		if report.Result.Kind != Errored || !errors.Is(report.Result.Err,ErrNoProgress) {
+			t.Errorf("star progress : expected no progress got %v",report.Result)
+		}
+	})
+}
+
+func TestStarBoolFormLogged(t *testing.T) {
+	WithTestFile(t,func(tmpfile string){
+		logger, buffer := testLogger(slog.LevelInfo)
+		var ctx = WithLogger(context.Background(),logger)
+		EvalLogged(ctx,"sqlite3",tmpfile,And(ExecuteSQL("create table p (p integer)"),StarProgress(One,"select count(*) from p")))
+		EvalLogged(ctx,"sqlite3",tmpfile,StarN(-1,One))
+		var lines = strings.Split(strings.TrimSpace(buffer.String()),"\n")
+		if len(lines) != 2 || !strings.Contains(lines[0],"level=ERROR") || !strings.Contains(lines[0],"no progress") ||
+			!strings.Contains(lines[1],"level=ERROR") || !strings.Contains(lines[1],"negative bound -1") {
+			t.Errorf("star : expected the bool forms to log their errors got %q",buffer.String())
+		}
+	})
+}
+
+func TestCheckedBatchEntry(t *testing.T) {
+	dbOperation(func(tx Executor){
+		if !And(CreateSchema,SaveBatch([]Entry{{1, 2, 10},{2, 3, 20}}),CheckedBatchEntry)(tx) {
+			t.Errorf("expected checked batch entry to process the batch")
+		}
+		if BatchExists(1)(tx) || BatchExists(2)(tx) {
+			t.Errorf("expected batch to be empty")
+		}
+	})
+}
+
+func TestStarReadOnlyGuard(t *testing.T) {
+	var count = 0
+	var guard = ReadOnlyLeafContext("guard",func(ctx context.Context,tx Executor) Result {
+		count++
+		if count > 2 {
+			return Failed("guard")
+		}
+		return Passed()
+	})
+	var fake = NewFakeExecutor()
+	var e = StarExpr(AndExpr(guard,LeafContext("c",ExecuteSQLContext("insert into a (a) VALUES (1)"))))
+	if r := e.Compile()(context.Background(),fake); !r.Ok() {
+		t.Errorf("star guard : expected success got %v",r)
+	}
+	var queries = fake.Queries()
+	if len(queries) != 6 || !strings.HasPrefix(queries[5],"release savepoint") {
+		t.Errorf("star guard : expected two iterations and no savepoint for the failed guard got %v",queries)
+	}
+}
@@ -3,11 +3,11 @@ package main
 import (
 	_ "github.com/mattn/go-sqlite3"
 	"testing"
+	"context"
 	"os"
 	_ "fmt"
 	_ "log"
 	"io/ioutil"
-	"database/sql"
 )
 
 func TestZero(t *testing.T) {
@@ -46,7 +46,7 @@ func WithTestExpression(t *testing.T,test KatExpression){
 }
 
 func assertExpression(t *testing.T,msg string,k KatExpression) KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		result := k(tx)
 		if !result {
 			t.Error(msg)
@@ -72,7 +72,7 @@ func TestCanExecuteSQL(t *testing.T) {
 }
 
 func TestCanExecuteQuery(t *testing.T) {
-	var hasOne = func(tx *sql.Tx) bool {
+	var hasOne = func(tx Executor) bool {
 		var result = false
 		var sql = "SELECT count(*) > 0 FROM a"
 		return ExecuteQuery(sql)(&result)(tx) && result
@@ -89,7 +89,7 @@ func TestCanExecuteQuery(t *testing.T) {
 }
 
 func TestCanHandleQuery(t *testing.T) {
-	var sumThree = func(tx *sql.Tx) bool {
+	var sumThree = func(tx Executor) bool {
 		var Tmp = 0
 		var Count = 0
 		var handler = func(){
@@ -125,7 +125,7 @@ func TestAndTransaction(t *testing.T) {
 	var insertOne = assertExpression(t,"and insert 1",ExecuteSQL("insert into b (b) VALUES (1)"))
 	var insertTwo = assertExpression(t,"and insert 2",ExecuteSQL("insert into b (b) VALUES (2)"))
 	var checkSum = func(expected int) KatExpression {
-		return func(tx *sql.Tx) bool {
+		return func(tx Executor) bool {
 			var Tmp = 0
 			var Count = 0
 			var handler = func(){
@@ -164,7 +164,7 @@ func TestOrTransaction(t *testing.T) {
 	var insertTwo = assertExpression(t,"or failed insert 2",ExecuteSQL("insert into b (b) VALUES (2)"))
 
 	var checkSum = func(expected int) KatExpression {
-		return func(tx *sql.Tx) bool {
+		return func(tx Executor) bool {
 			var Tmp = 0
 			var Count = 0
 			var handler = func(){
@@ -205,7 +205,7 @@ func TestOrTransaction(t *testing.T) {
 func TestStarTransaction(t *testing.T) {
 	var insertOne = assertExpression(t,"or failed insert 1",ExecuteSQL("insert into s (s) VALUES (1)"))
 	var checkSum = func(expected int) KatExpression {
-		return func(tx *sql.Tx) bool {
+		return func(tx Executor) bool {
 			var Tmp = 0
 			var Count = 0
 			var handler = func(){
@@ -217,7 +217,7 @@ func TestStarTransaction(t *testing.T) {
 	}
 	var insertn = func(excepted int) KatExpression {
 		var Count = 0
-		return func(tx *sql.Tx) bool {
+		return func(tx Executor) bool {
 			Count = Count + 1
 			if Count <= excepted {
 				return insertOne(tx)
@@ -232,3 +232,16 @@ func TestStarTransaction(t *testing.T) {
 	WithTestExpression(t,assertExpression(t,"star : empty",And(createTable,checkSum(0),dropTable)))
 	WithTestExpression(t,assertExpression(t,"star : 5",And(createTable,checkSum(0),Star(insertn(5)),checkSum(5),dropTable)))
 }
+
+/* the cost of the combinators and their savepoints without a database */
+func BenchmarkCombinators(b *testing.B) {
+	var fake = NewFakeExecutor()
+	var ctx = context.Background()
+	var op = AndContext(OrContext(ZeroContext,OneContext),StarNContext(3,OneContext),NotContext(ZeroContext))
+	for i := 0; i < b.N; i++ {
+		fake.Statements = nil
+		if r := op(ctx,fake); !r.Ok() {
+			b.Fatal(r)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* one combinator or leaf evaluation */
+type TraceNode struct {
+	Name       string        `json:"name"`
+	Args       []interface{} `json:"args,omitempty"`
+	Result     Result        `json:"result"`
+	Duration   time.Duration `json:"duration"`
+	Savepoints []SavepointTrace `json:"savepoints,omitempty"`
+	Children   []*TraceNode  `json:"children,omitempty"`
+}
+
+/* a savepoint opened by a combinator, one per branch or iteration */
+type SavepointTrace struct {
+	Name       string `json:"name"`
+	RolledBack bool   `json:"rolledBack,omitempty"`
+}
+
+/* collects the evaluation tree when installed with WithTracer */
+type Tracer struct {
+	lock  sync.Mutex
+	Roots []*TraceNode
+}
+
+type tracerKey struct{}
+
+type traceNodeKey struct{}
+
+func NewTracer() *Tracer { return &Tracer{} }
+
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+func enterTrace(ctx context.Context, name string, args []interface{}) (context.Context, *TraceNode) {
+	tracer, ok := ctx.Value(tracerKey{}).(*Tracer)
+	if !ok {
+		return ctx, nil
+	}
+	var node = &TraceNode{Name: name, Args: args}
+	tracer.lock.Lock()
+	if parent, ok := ctx.Value(traceNodeKey{}).(*TraceNode); ok {
+		parent.Children = append(parent.Children, node)
+	} else {
+		tracer.Roots = append(tracer.Roots, node)
+	}
+	tracer.lock.Unlock()
+	return context.WithValue(ctx, traceNodeKey{}, node), node
+}
+
+func exitTrace(node *TraceNode, start time.Time, result Result) Result {
+	if node != nil {
+		node.Result = result
+		node.Duration = time.Since(start)
+	}
+	return result
+}
+
+/* records a savepoint on the innermost traced combinator */
+func traceSavepoint(ctx context.Context, savepoint string, rolledBack bool) {
+	tracer, ok := ctx.Value(tracerKey{}).(*Tracer)
+	if !ok {
+		return
+	}
+	node, ok := ctx.Value(traceNodeKey{}).(*TraceNode)
+	if !ok {
+		return
+	}
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	for i := range node.Savepoints {
+		if node.Savepoints[i].Name == savepoint {
+			node.Savepoints[i].RolledBack = node.Savepoints[i].RolledBack || rolledBack
+			return
+		}
+	}
+	node.Savepoints = append(node.Savepoints, SavepointTrace{savepoint, rolledBack})
+}
+
+func traced(name string, op KatContextExpression) KatContextExpression {
+	return func(ctx context.Context, tx Executor) Result {
+		var start = time.Now()
+		ctx, node := enterTrace(ctx, name, nil)
+		return exitTrace(node, start, observed(ctx, CombinatorSpan, name, func() Result { return op(ctx, tx) }))
+	}
+}
+
+/* the bool combinators are traced and observed like the context forms */
+func tracedBool(name string, op KatExpression) KatExpression {
+	var node = traced(name, func(ctx context.Context, tx Executor) Result {
+		if op(withContext(ctx, tx)) {
+			return Passed()
+		}
+		return Failed(name)
+	})
+	return func(tx Executor) bool {
+		return node(contextOf(tx), tx).Ok()
+	}
+}
+
+func (node *TraceNode) write(builder *strings.Builder, depth int) {
+	builder.WriteString(strings.Repeat("  ", depth))
+	builder.WriteString(node.Name)
+	if len(node.Args) > 0 {
+		fmt.Fprintf(builder, " %v", node.Args)
+	}
+	fmt.Fprintf(builder, " => %v (%v)", node.Result, node.Duration)
+	for _, savepoint := range node.Savepoints {
+		fmt.Fprintf(builder, " savepoint %v", savepoint.Name)
+		if savepoint.RolledBack {
+			builder.WriteString(" rolled back")
+		}
+	}
+	builder.WriteString("\n")
+	for _, child := range node.Children {
+		child.write(builder, depth+1)
+	}
+}
+
+func (tracer *Tracer) String() string {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	var builder strings.Builder
+	for _, root := range tracer.Roots {
+		root.write(&builder, 0)
+	}
+	return builder.String()
+}
+
+/* how often every traced node ran, keyed like the leaves print : name(args) */
+func (tracer *Tracer) Hits() map[string]int {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	var hits = map[string]int{}
+	var count func(nodes []*TraceNode)
+	count = func(nodes []*TraceNode) {
+		for _, node := range nodes {
+			hits[LeafNode{Name: node.Name, Params: node.Args}.String()]++
+			count(node.Children)
+		}
+	}
+	count(tracer.Roots)
+	return hits
+}
+
+func (tracer *Tracer) JSON() ([]byte, error) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	return json.MarshalIndent(tracer.Roots, "", "  ")
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	var value = struct {
+		Kind     string `json:"kind"`
+		Step     string `json:"step,omitempty"`
+		Error    string `json:"error,omitempty"`
+		Attempts int    `json:"attempts,omitempty"`
+	}{Kind: r.Kind.String(), Step: r.Step, Attempts: r.Attempts}
+	if r.Err != nil {
+		value.Error = r.Err.Error()
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"strings"
+	"encoding/json"
+	"database/sql"
+)
+
+func TestTracerOff(t *testing.T) {
+	if r := AndContext(OneContext)(context.Background(),nil); !r.Ok() {
+		t.Errorf("trace : expected untraced and to pass got %v",r)
+	}
+}
+
+func TestTracerTree(t *testing.T) {
+	var tracer = NewTracer()
+	var ctx = WithTracer(context.Background(),tracer)
+	var insertOne = ExecuteSQLContext("insert into b (b) VALUES (?)",1)
+	var insertTwo = ExecuteSQLContext("insert into b (b) VALUES (?)",2)
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,ExecuteSQLContext("create table b (b integer)"))
+		var report = EvalDB(ctx,db,AndContext(OrContext(AndContext(insertOne,ZeroContext),insertTwo),NotContext(ZeroContext)))
+		if !report.Committed {
+			t.Errorf("trace : expected commit got %v",report)
+		}
+	})
+	if len(tracer.Roots) != 1 || tracer.Roots[0].Name != "And" || !tracer.Roots[0].Result.Ok() {
+		t.Fatalf("trace : expected one and root got %v",tracer)
+	}
+	var or = tracer.Roots[0].Children[0]
+	if or.Name != "Or" || len(or.Savepoints) != 1 || !or.Savepoints[0].RolledBack {
+		t.Errorf("trace : expected rolled back or got %+v",or)
+	}
+	var names []string
+	for _, child := range or.Children {
+		names = append(names,strings.Fields(child.Name)[0])
+	}
+	if strings.Join(names," ") != "savepoint And rollback ExecuteSQL release" {
+		t.Errorf("trace : unexpected or children %v",names)
+	}
+	var failed = or.Children[1]
+	if failed.Result.Kind != TestFailed || len(failed.Children) != 1 || failed.Children[0].Args[1] != 1 {
+		t.Errorf("trace : expected failed branch with insert 1 got %+v",failed)
+	}
+	var text = tracer.String()
+	if !strings.Contains(text,"\n  Or => success") || !strings.Contains(text,"rolled back") {
+		t.Errorf("trace : unexpected text\n%v",text)
+	}
+}
+
+func TestTracerJSON(t *testing.T) {
+	var tracer = NewTracer()
+	AndContext(OneContext,ZeroContext)(WithTracer(context.Background(),tracer),nil)
+	data, err := tracer.JSON()
+	if err != nil {
+		t.Fatalf("trace : json %v",err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(data,&decoded); err != nil {
+		t.Fatalf("trace : could not decode %s",data)
+	}
+	var result = decoded[0]["result"].(map[string]interface{})
+	if decoded[0]["name"] != "And" || result["kind"] != "test failed" || result["step"] != "Zero" {
+		t.Errorf("trace : unexpected json %s",data)
+	}
+}
+
+func TestTracerBoolCombinators(t *testing.T) {
+	var tracer = NewTracer()
+	var count = 0
+	var three = func(tx Executor) bool {
+		count++
+		return count <= 3
+	}
+	var report = EvalOpen(WithTracer(context.Background(),tracer),"sqlite3",":memory:",LiftContext(And(Star(three),Or(Zero,One))))
+	if !report.Result.Ok() {
+		t.Fatalf("trace : expected success got %v",report)
+	}
+	var and = tracer.Roots[0]
+	if len(tracer.Roots) != 1 || and.Name != "And" {
+		t.Fatalf("trace : expected a bool and root got\n%v",tracer)
+	}
+	var star, or *TraceNode
+	for _, child := range and.Children {
+		switch child.Name {
+		case "Star":
+			star = child
+		case "Or":
+			or = child
+		}
+	}
+	if star == nil || len(star.Savepoints) != 4 || star.Savepoints[2].RolledBack || !star.Savepoints[3].RolledBack {
+		t.Errorf("trace : expected a star with 4 savepoints the last rolled back got %+v",star)
+	}
+	if or == nil || len(or.Savepoints) != 1 || !or.Savepoints[0].RolledBack {
+		t.Errorf("trace : expected a rolled back or got %+v",or)
+	}
+}
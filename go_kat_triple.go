@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ Hoare triples {P} C {Q}. The step of a failed triple names the triple
+ and the part that failed, "removeBatch: postcondition: batchExists(1)",
+ its Err is a *TripleError that errors.As finds, and every failure is
+ recorded in EvalReport.Violations so a batch run can report them all.
+*/
+
+type ContractPart int
+
+const (
+	Precondition ContractPart = iota
+	Command
+	Postcondition
+)
+
+func (part ContractPart) String() string {
+	switch part {
+	case Precondition:
+		return "precondition"
+	case Command:
+		return "command"
+	case Postcondition:
+		return "postcondition"
+	}
+	return fmt.Sprintf("ContractPart(%d)", int(part))
+}
+
+/* the part of a named triple that failed and how */
+type ContractViolation struct {
+	Triple string
+	Part   ContractPart
+	Result Result
+}
+
+func (violation ContractViolation) String() string {
+	return fmt.Sprintf("%v %v: %v", violation.Triple, violation.Part, violation.Result)
+}
+
+/* the error of a failed triple, Err is the error of the part and nil when its test failed */
+type TripleError struct {
+	Triple string
+	Part   ContractPart
+	Err    error
+}
+
+func (err *TripleError) Error() string {
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%v %v failed", err.Triple, err.Part)
+}
+
+func (err *TripleError) Unwrap() error { return err.Err }
+
+type debugKey struct{}
+
+/* enables the checks that are only made while debugging */
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+func Debugging(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return debug
+}
+
+func recordViolation(ctx context.Context, violation ContractViolation) {
+	if recorder, ok := ctx.Value(stepsKey{}).(*stepRecorder); ok {
+		recorder.lock.Lock()
+		recorder.violations = append(recorder.violations, violation)
+		recorder.lock.Unlock()
+	}
+}
+
+func triple(name string, pre KatContextExpression, cmd KatContextExpression, post KatContextExpression, debugOnly bool) KatContextExpression {
+	var violated = func(ctx context.Context, part ContractPart, r Result) Result {
+		recordViolation(ctx, ContractViolation{name, part, r})
+		r.Step = fmt.Sprintf("%v: %v: %v", name, part, r.Step)
+		r.Err = &TripleError{name, part, r.Err}
+		return r
+	}
+	return traced("Triple", func(ctx context.Context, tx Executor) Result {
+		if r := pre(ctx, tx); !r.Ok() {
+			return violated(ctx, Precondition, r)
+		}
+		if r := cmd(ctx, tx); !r.Ok() {
+			return violated(ctx, Command, r)
+		}
+		if debugOnly && !Debugging(ctx) {
+			return Passed()
+		}
+		if r := post(ctx, tx); !r.Ok() {
+			return violated(ctx, Postcondition, r)
+		}
+		return Passed()
+	})
+}
+
+func Triple(name string, pre KatContextExpression, cmd KatContextExpression, post KatContextExpression) (KatContextExpression) {
+	return triple(name, pre, cmd, post, false)
+}
+
+/* like Triple but the postcondition is only checked when ctx is debugging */
+func DebugTriple(name string, pre KatContextExpression, cmd KatContextExpression, post KatContextExpression) (KatContextExpression) {
+	return triple(name, pre, cmd, post, true)
+}
+
+/* counts the violations by triple and part, one line each */
+func ViolationReport(violations []ContractViolation) string {
+	var counts = map[string]int{}
+	for _, violation := range violations {
+		counts[fmt.Sprintf("%v %v", violation.Triple, violation.Part)]++
+	}
+	var lines []string
+	for key, count := range counts {
+		lines = append(lines, fmt.Sprintf("%v: %d", key, count))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
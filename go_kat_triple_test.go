@@ -0,0 +1,95 @@
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+	"context"
+	"errors"
+	"database/sql"
+)
+
+/* the part a failed triple reports through its *TripleError */
+func triplePart(t *testing.T,r Result) ContractPart {
+	var tripleErr *TripleError
+	if !errors.As(r.Err,&tripleErr) {
+		t.Fatalf("triple : expected a triple error got %v",r)
+	}
+	return tripleErr.Part
+}
+
+func TestTripleParts(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var ctx = context.Background()
+	if r := Triple("t",OneContext,OneContext,OneContext)(ctx,fake); !r.Ok() || r.Err != nil {
+		t.Errorf("triple : expected success got %v",r)
+	}
+	for _, test := range []struct {
+		triple KatContextExpression
+		part   ContractPart
+	}{
+		{Triple("t",ZeroContext,OneContext,OneContext),Precondition},
+		{Triple("t",OneContext,ZeroContext,OneContext),Command},
+		{Triple("t",OneContext,OneContext,ZeroContext),Postcondition},
+	} {
+		var r = test.triple(ctx,fake)
+		if r.Kind != TestFailed || triplePart(t,r) != test.part || r.Step != "t: " + test.part.String() + ": Zero" {
+			t.Errorf("triple : expected %v failure got %v",test.part,r)
+		}
+	}
+}
+
+func TestTripleError(t *testing.T) {
+	var locked = errors.New("locked")
+	var fake = NewFakeExecutor().Fail("delete from v",locked)
+	var r = Triple("t",OneContext,ExecuteSQLContext("delete from v"),OneContext)(context.Background(),fake)
+	if r.Kind != Errored || triplePart(t,r) != Command || !errors.Is(r.Err,locked) {
+		t.Errorf("triple : expected the command error got %v",r)
+	}
+}
+
+func TestDebugTriple(t *testing.T) {
+	var fake = NewFakeExecutor()
+	var checked = 0
+	var post = counted(&checked,Failed("post"))
+	if r := DebugTriple("t",OneContext,OneContext,post)(context.Background(),fake); !r.Ok() || checked != 0 {
+		t.Errorf("triple : expected postcondition skipped got %v %v",r,checked)
+	}
+	if r := DebugTriple("t",OneContext,OneContext,post)(WithDebug(context.Background()),fake); r.Kind != TestFailed || checked != 1 {
+		t.Errorf("triple : expected postcondition checked got %v %v",r,checked)
+	}
+}
+
+func TestTripleViolationReport(t *testing.T) {
+	var broken = func(n int) KatContextExpression {
+		return Triple("broken",OneContext,OneContext,ZeroContext)
+	}
+	var missing = Triple("missing",ZeroContext,OneContext,OneContext)
+	WithTestDB(t,func(db *sql.DB){
+		EvalDB(context.Background(),db,AndContext(ExecuteSQLContext("create table v (v integer)"),
+			                                  ExecuteSQLContext("insert into v (v) VALUES (1),(2)")))
+		var report = EvalDB(context.Background(),db,AndContext(ForEachRow(broken,"select v from v"),
+			                                               OrContext(missing,OneContext)))
+		if !report.Committed || len(report.Violations) != 3 {
+			t.Fatalf("triple : expected three violations got %v %v",report,report.Violations)
+		}
+		var expected = "broken postcondition: 2\nmissing precondition: 1"
+		if s := ViolationReport(report.Violations); s != expected {
+			t.Errorf("triple : expected report %q got %q",expected,s)
+		}
+	})
+}
+
+func TestRemoveBatchTriple(t *testing.T) {
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,AndContext(LiftContext(CreateSchema),
+			                                               LiftContext(SaveBatch([]Entry{{1, 2, 10}})),
+			                                               RemoveBatchTriple(1)))
+		if !report.Committed {
+			t.Errorf("triple : expected remove batch to hold got %v",report)
+		}
+		report = EvalDB(context.Background(),db,RemoveBatchTriple(1))
+		if report.Result.Kind != TestFailed || triplePart(t,report.Result) != Precondition {
+			t.Errorf("triple : expected missing batch precondition got %v",report.Result)
+		}
+	})
+}
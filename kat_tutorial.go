@@ -1,7 +1,8 @@
 package main
 
 import ("os"
-	"database/sql"
+	"context"
+	"log/slog"
 	"fmt"
 	"flag"
 	"log"
@@ -11,13 +12,13 @@ import ("os"
 )
 
 type Entry struct {
-	FromId         int `json:"FromId"`
-	ToId           int `json:"ToId"`
-	TransferAmount int `json:"TransferAmount"`
+	FromId         int `json:"FromId" kat:"FromId"`
+	ToId           int `json:"ToId" kat:"ToId"`
+	TransferAmount int `json:"TransferAmount" kat:"TransferAmount"`
 }
 
 func PositiveTransfer(entry Entry)  KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		return entry.TransferAmount > 0
 	}
 }
@@ -28,11 +29,14 @@ var CreateLedger = ExecuteSQL(`CREATE TABLE IF NOT EXISTS ledger
 var DropLedger = ExecuteSQL("DROP TABLE IF EXISTS ledger")
 
 /* batch */
-var CreateBatch = ExecuteSQL(`CREATE TABLE IF NOT EXISTS batch
-                                     (Id integer primary key autoincrement,
-                                      FromId integer,
-                                      ToId integer,
-                                      TransferAmount integer)`)
+var CreateBatch KatExpression = func(tx Executor) bool {
+	var id = DialectOf(contextOf(tx)).AutoIncrement("Id")
+	return ExecuteSQL(`CREATE TABLE IF NOT EXISTS batch
+                             (` + id + `,
+                              FromId integer,
+                              ToId integer,
+                              TransferAmount integer)`)(tx)
+}
 var DropBatch = ExecuteSQL("DROP TABLE IF EXISTS batch")
 
 /* quarantine */
@@ -50,69 +54,73 @@ var CreateSchema = And(DropLedger,
 	               DropQuarantine,
  	               CreateQuarantine)
 
-func DumpBatch(tx *sql.Tx) bool {
+type BatchRow struct {
+	Id             int `kat:"Id"`
+	FromId         int `kat:"FromId"`
+	ToId           int `kat:"ToId"`
+	TransferAmount int `kat:"TransferAmount"`
+}
+
+type LedgerRow struct {
+	UserId      int `kat:"UserId"`
+	UserBalance int `kat:"UserBalance"`
+}
+
+func DumpBatch(tx Executor) bool {
 	fmt.Printf("Batch\n")
-	var Id = -1
-	var FromId = -1
-	var ToId = -1
-	var TransferAmount = -1
-	var handler = func(){
+	var handler = func(row BatchRow) Result {
 		fmt.Printf("{ Id: %v , FromId: %v , ToId : %v , TransferAmount : %v }\n",
-			  Id,
-			  FromId,
-	                  ToId,
-			  TransferAmount)
+			  row.Id,
+			  row.FromId,
+	                  row.ToId,
+			  row.TransferAmount)
+		return Passed()
 	}
 	var sql = `select Id,
 			  FromId,
 	                  ToId,
 			  TransferAmount
                     from batch`
-	return HandleQuery(sql)(tx,handler,&Id,&FromId,&ToId,&TransferAmount)
+	return LowerContext(QueryEach(handler,sql))(tx)
 }
 
 
-func DumpLedger(tx *sql.Tx) bool {
+func DumpLedger(tx Executor) bool {
 	fmt.Printf("Ledger\n")
-	var UserId = -1
-	var UserBalance = -1
-	var handler = func(){
+	var handler = func(row LedgerRow) Result {
 		fmt.Printf("{ UserId: %v , UserBalance %v }\n",
-			   UserId,
-			   UserBalance)
+			   row.UserId,
+			   row.UserBalance)
+		return Passed()
 	}
 	var sql = `select UserId ,
                    UserBalance from ledger`
-	return HandleQuery(sql)(tx,handler,&UserId,&UserBalance)
+	return LowerContext(QueryEach(handler,sql))(tx)
 }
 
-func DumpQuarantine(tx *sql.Tx) bool {
+func DumpQuarantine(tx Executor) bool {
 	fmt.Printf("Quarantine\n")
-	var from_id = -1
-	var to_balance = -1
-	var transfer_amount = -1
-	var handler = func(){
+	var handler = func(entry Entry) Result {
 		fmt.Printf("{ from_id : %v , to_balance : %v , transfer_amount : %v }\n",
-                           from_id,
-			   to_balance,
-			   transfer_amount)
+                           entry.FromId,
+			   entry.ToId,
+			   entry.TransferAmount)
+		return Passed()
 	}
 	var sql = `select FromId,
 			   ToId,
 			   TransferAmount
                    from quarantine`
-	return HandleQuery(sql)(tx,handler,&from_id,&to_balance,&transfer_amount)
-	return true
+	return LowerContext(QueryEach(handler,sql))(tx)
 }
 
 var DumpState = And(DumpBatch,DumpLedger,DumpQuarantine)
 
 func UserExists(id int) KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		var result = false
 		var sql = "SELECT count(*) > 0 FROM ledger WHERE UserId=?"
-		result = ExecuteQuery(sql,id)(&result)(tx) && result
-		return  result
+		return LowerContext(QueryValue(&result,sql,id))(tx) && result
 	}
 }
 
@@ -175,10 +183,10 @@ func QuarantineTransaction(entry Entry) KatExpression {
 }
 
 func UserBalancePositive(id int) KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		var result = false
 		var sql = "SELECT UserBalance > 0 FROM ledger WHERE UserId=?"
-		return ExecuteQuery(sql,id)(&result)(tx) && result
+		return LowerContext(QueryValue(&result,sql,id))(tx) && result
 	}
 }
 
@@ -190,18 +198,17 @@ func ReceiverPositiveBalance(entry Entry) KatExpression {
 	return UserBalancePositive(entry.ToId)
 }
 
+/* through the reified flow, the read-only test needs no savepoint */
 func EnsureSender(entry Entry) KatExpression {
-	return Or(SenderExists(entry),
-		         CreateSender(entry))
+	return CompileBool(EnsureSenderExpr(entry))
 }
 
 func EnsureReciever(entry Entry) KatExpression {
-	return Or(RecieverExists(entry),
-		         CreateReciever(entry))
+	return CompileBool(EnsureRecieverExpr(entry))
 }
 
 func SaveBatch(entries []Entry) KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		for _, entry := range entries {
 			var sql = `INSERT INTO batch
                                    (FromId,ToId,TransferAmount)
@@ -221,11 +228,10 @@ func DeleteBatch(id int) KatExpression {
 }
 
 func BatchExists(id int) KatExpression {
-	return func(tx *sql.Tx) bool {
+	return func(tx Executor) bool {
 		var result = false
 		var sql = "SELECT count(*) > 0 FROM batch WHERE id=?"
-		result = ExecuteQuery(sql,id)(&result)(tx) && result
-		return  result
+		return LowerContext(QueryValue(&result,sql,id))(tx) && result
 	}
 }
 
@@ -233,25 +239,74 @@ func RemoveBatch(id int) KatExpression {
 	return And(BatchExists(id),DeleteBatch(id),Not(BatchExists(id)))
 }
 
+/* removeBatch as a Hoare triple, a violation names the part that failed */
+func RemoveBatchTriple(id int) KatContextExpression {
+	return Triple("removeBatch",
+	              LiftContext(BatchExists(id)),
+	              LiftContext(DeleteBatch(id)),
+	              LiftContext(Not(BatchExists(id))))
+}
+
 func ProcessEntry(id int,entry Entry) KatExpression {
-	return And(RemoveBatch(id),
-	           Or(And(EnsureSender(entry),
-	                  EnsureReciever(entry),
-	                  VerifyTransaction(entry),
-	                  SaveTransaction(entry),
-	                  SenderPositiveBalance(entry),
-			  ReceiverPositiveBalance(entry)),
-	              QuarantineTransaction(entry)))
+	return CompileBool(ProcessEntryExpr(id,entry))
+}
+
+/* reified flows, String() gives the notation used in the README */
+func RemoveBatchExpr(id int) Expr {
+	return AndExpr(ReadOnlyLeaf("batchExists",BatchExists(id),id),
+	               Leaf("deleteBatch",DeleteBatch(id),id),
+	               NotExpr(ReadOnlyLeaf("batchExists",BatchExists(id),id)))
+}
+
+func EnsureSenderExpr(entry Entry) Expr {
+	return OrExpr(ReadOnlyLeaf("senderExists",SenderExists(entry),entry.FromId),
+	              Leaf("createSender",CreateSender(entry),entry.FromId))
+}
+
+func EnsureRecieverExpr(entry Entry) Expr {
+	return OrExpr(ReadOnlyLeaf("recieverExists",RecieverExists(entry),entry.ToId),
+	              Leaf("createReciever",CreateReciever(entry),entry.ToId))
 }
 
+func VerifyTransactionExpr(entry Entry) Expr {
+	return AndExpr(ReadOnlyLeaf("positiveTransfer",PositiveTransfer(entry),entry.TransferAmount),
+	               ReadOnlyLeaf("senderExists",SenderExists(entry),entry.FromId),
+	               ReadOnlyLeaf("recieverExists",RecieverExists(entry),entry.ToId))
+}
+
+func ProcessEntryExpr(id int,entry Entry) Expr {
+	return AndExpr(RemoveBatchExpr(id),
+	               OrExpr(AndExpr(EnsureSenderExpr(entry),
+	                              EnsureRecieverExpr(entry),
+	                              VerifyTransactionExpr(entry),
+	                              Leaf("saveTransaction",SaveTransaction(entry),entry.FromId,entry.ToId,entry.TransferAmount),
+	                              ReadOnlyLeaf("senderPositiveBalance",SenderPositiveBalance(entry),entry.FromId),
+	                              ReadOnlyLeaf("receiverPositiveBalance",ReceiverPositiveBalance(entry),entry.ToId)),
+	                      Leaf("quarantineTransaction",QuarantineTransaction(entry),entry.FromId,entry.ToId,entry.TransferAmount)))
+}
+
+/* the atoms of the reified flows so their notation can be parsed back */
+var LedgerAtoms = NewRegistry().
+	RegisterReadOnly("batchExists",BatchExists).
+	Register("deleteBatch",DeleteBatch).
+	RegisterReadOnly("senderExists",UserExists).
+	RegisterReadOnly("recieverExists",UserExists).
+	Register("createSender",CreateUser).
+	Register("createReciever",CreateUser).
+	RegisterReadOnly("positiveTransfer",func(amount int) KatExpression { return PositiveTransfer(Entry{TransferAmount: amount}) }).
+	Register("saveTransaction",func(from int,to int,amount int) KatExpression { return SaveTransaction(Entry{from,to,amount}) }).
+	RegisterReadOnly("senderPositiveBalance",UserBalancePositive).
+	RegisterReadOnly("receiverPositiveBalance",UserBalancePositive).
+	Register("quarantineTransaction",func(from int,to int,amount int) KatExpression { return QuarantineTransaction(Entry{from,to,amount}) })
+
 func ProcessBatch(op (func(int,Entry) KatExpression)) KatExpression {
-	return func(tx *sql.Tx) bool {
-		var id , fromId , toId, transferAmount = -1, -1, -1, -1
+	return func(tx Executor) bool {
+		var row BatchRow
 		var sql = `SELECT Id, FromId, ToId, TransferAmount
                            FROM batch`
-		var result = ExecuteQuery(sql,id)(&id,&fromId,&toId,&transferAmount)(tx)
+		var result = LowerContext(QueryValue(&row,sql))(tx)
 		if result {
-			result = op(id,Entry{fromId , toId, transferAmount})(tx)
+			result = op(row.Id,Entry{row.FromId , row.ToId, row.TransferAmount})(tx)
 		}
 		return result
 	}
@@ -259,6 +314,18 @@ func ProcessBatch(op (func(int,Entry) KatExpression)) KatExpression {
 
 var BatchEntry = Star(ProcessBatch(ProcessEntry))
 
+/* BatchEntry that stops with ErrNoProgress when an entry is processed without leaving batch */
+var CheckedBatchEntry = StarProgress(ProcessBatch(ProcessEntry),"SELECT count(*) FROM batch")
+
+/* the entry is only known once the batch is read, the graph draws processBatch as one box */
+var BatchEntryExpr = StarExpr(Leaf("processBatch",ProcessBatch(ProcessEntry)))
+
+/* processes every batch row once, a row that cannot be processed stays in batch */
+var BatchRows = ForEachRow(func(row BatchRow) KatContextExpression {
+	return ProcessEntryExpr(row.Id,Entry{row.FromId , row.ToId, row.TransferAmount}).Compile()
+},`SELECT Id, FromId, ToId, TransferAmount
+   FROM batch`)
+
 func ProcessFile(path string) []Entry {
 
 	var result []Entry
@@ -288,21 +355,55 @@ func ProcessFile(path string) []Entry {
 
 func main() {
 	var inFileFlagPtr = flag.String("infile", "", "in file")
-	var dbFileFlagPtr = flag.String("dbfile", "", "db file")
+	var dbFileFlagPtr = flag.String("dbfile", "", "db file or data source name")
+	var driverPtr = flag.String("driver", "sqlite3", "database/sql driver, it picks the SQL dialect")
 	var dbVerbosePtr = flag.Bool("verbose", false, "verbose ")
+	var dryRunPtr = flag.Bool("dry-run", false, "print the changes to the tables and roll back")
+	var metricsPtr = flag.String("metrics", "", "write Prometheus metrics of the run to this file")
 
 	flag.Parse()
 	fmt.Println("infile:", *inFileFlagPtr)
 	fmt.Println("dbfile:", *dbFileFlagPtr)
+	fmt.Println("driver:", *driverPtr)
 	fmt.Println("verbose:", *dbVerbosePtr)
+	fmt.Println("dry-run:", *dryRunPtr)
 
-	if(!*dbVerbosePtr){
-		LogMessage = func(msg string){}
+	var level = slog.LevelInfo
+	if(*dbVerbosePtr){
+		level = slog.LevelDebug
+	}
+	var logger = slog.New(slog.NewTextHandler(os.Stderr,&slog.HandlerOptions{Level: level}))
+	var ctx = WithLogger(context.Background(),logger)
+	var metrics = NewMetrics()
+	if *metricsPtr != "" {
+		ctx = WithObserver(ctx,metrics)
 	}
 
 	var ops = And(CreateSchema,
 		      SaveBatch(ProcessFile(*inFileFlagPtr)),
-		      BatchEntry,
+		      CheckedBatchEntry,
 		      DumpState)
-	Eval("sqlite3",*dbFileFlagPtr,ops)
+	if *dryRunPtr {
+		DryRun(ctx,*driverPtr,*dbFileFlagPtr,ops)
+	} else {
+		EvalLogged(ctx,*driverPtr,*dbFileFlagPtr,ops)
+	}
+	if *metricsPtr != "" {
+		if err := metrics.WritePrometheusFile(*metricsPtr); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+/* runs ops, prints what changed in the ledger tables and rolls back */
+func DryRun(ctx context.Context,driverName string,dbFile string,ops KatExpression) {
+	ctx = WithDryRun(ctx,"ledger","batch","quarantine")
+	var report = EvalOpen(ctx,driverName,dbFile,LiftContext(ops))
+	if report.Err != nil {
+		log.Fatal(report.Err)
+	}
+	fmt.Printf("Dry run: %v\n",report.Result)
+	for _, diff := range report.Diffs {
+		fmt.Print(diff)
+	}
 }
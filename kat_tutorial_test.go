@@ -2,10 +2,14 @@ package main
 
 import (
 	"testing"
+	"context"
 	"fmt"
 	"database/sql"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"path/filepath"
+	"strings"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -17,7 +21,7 @@ func TestPostiveBalance(t *testing.T) {
 }
 
 func TestSenderExists(t *testing.T) {
-	dbOperation(func(tx *sql.Tx){
+	dbOperation(func(tx Executor){
 		entry := Entry{1, 1, 1}
 
 		if !And(CreateSchema)(tx) {
@@ -30,7 +34,7 @@ func TestSenderExists(t *testing.T) {
 	})
 }
 
-func dbOperation(op func(*sql.Tx)) {
+func dbOperation(op func(Executor)) {
 	tmpfile, err := ioutil.TempFile("", "kat_test")
 	if err != nil {
 		log.Fatal(err)
@@ -44,19 +48,54 @@ func dbOperation(op func(*sql.Tx)) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	op(tx)
+	op(NewTxExecutor(tx,SQLiteDialect{}))
 	defer db.Close()
 
 }
 
 func TestCreateSchema(t *testing.T) {
-	dbOperation(func(tx *sql.Tx){
+	dbOperation(func(tx Executor){
 		if !CreateSchema(tx) {
 			t.Errorf("could not create schema")
 		}
 	})
 }
 
+func TestProcessEntryExpr(t *testing.T) {
+	var expected = "(batchExists(4) * deleteBatch(4) * !batchExists(4))" +
+		" * ((senderExists(1) + createSender(1))" +
+		" * (recieverExists(2) + createReciever(2))" +
+		" * (positiveTransfer(10) * senderExists(1) * recieverExists(2))" +
+		" * saveTransaction(1, 2, 10) * senderPositiveBalance(1) * receiverPositiveBalance(2)" +
+		" + quarantineTransaction(1, 2, 10))"
+	if s := ProcessEntryExpr(4,Entry{1, 2, 10}).String(); s != expected {
+		t.Errorf("expected %v got %v",expected,s)
+	}
+}
+
+func TestBatchRows(t *testing.T) {
+	var entries = []Entry{{1, 2, 10},{2, 3, 20},{2, 3, 200}}
+	var ledger []LedgerRow
+	var quarantine []Entry
+	WithTestDB(t,func(db *sql.DB){
+		var report = EvalDB(context.Background(),db,AndContext(LiftContext(CreateSchema),
+			                                               LiftContext(SaveBatch(entries)),
+			                                               BatchRows,
+			                                               QuerySlice(&ledger,"select UserId, UserBalance from ledger order by UserId"),
+			                                               QuerySlice(&quarantine,"select FromId, ToId, TransferAmount from quarantine")))
+		if !report.Committed || len(report.Rows) != 3 {
+			t.Fatalf("expected batch rows to commit got %v %v",report,report.Rows)
+		}
+	})
+	var expected = []LedgerRow{{1, 90},{2, 90},{3, 120}}
+	if fmt.Sprint(ledger) != fmt.Sprint(expected) {
+		t.Errorf("expected ledger %v got %v",expected,ledger)
+	}
+	if len(quarantine) != 1 || quarantine[0] != entries[2] {
+		t.Errorf("expected quarantine %v got %v",entries[2],quarantine)
+	}
+}
+
 /*
 func PositiveTransfer(entry Entry)  KatExpression {
 var CreateLedger = ExecuteSQL(`CREATE TABLE IF NOT EXISTS ledger
@@ -64,8 +103,8 @@ var DropLedger = ExecuteSQL("DROP TABLE IF EXISTS ledger")
 var CreateQuarantine = ExecuteSQL(`CREATE TABLE IF NOT EXISTS quarantine
 var DropQuarantine = ExecuteSQL("DROP TABLE IF EXISTS quarantine")
 var CreateSchema = And(DropLedger,
-func DumpLedger(tx *sql.Tx) bool {
-func DumpQuarantine(tx *sql.Tx) bool {
+func DumpLedger(tx Executor) bool {
+func DumpQuarantine(tx Executor) bool {
 var DumpState = And(DumpLedger,DumpQuarantine)
 func UserExists(id int) KatExpression {
 func SenderExists(entry Entry) KatExpression {
@@ -87,3 +126,188 @@ func ProcessBatch(entries []Entry) KatExpression {
 func ProcessFile(path string) []Entry {
 func main
 */
+
+/* e with every leaf declared mutating, as before effects were declared */
+func allMutating(e Expr) Expr {
+	switch node := e.(type) {
+	case LeafNode:
+		node.Effect = Mutating
+		return node
+	case AndNode:
+		return AndNode{allMutatingArgs(node.Args)}
+	case OrNode:
+		return OrNode{allMutatingArgs(node.Args)}
+	case NotNode:
+		return NotNode{allMutating(node.Arg)}
+	case StarNode:
+		return StarNode{allMutating(node.Arg)}
+	}
+	return e
+}
+
+func allMutatingArgs(args []Expr) []Expr {
+	var result = make([]Expr, len(args))
+	for i, arg := range args {
+		result[i] = allMutating(arg)
+	}
+	return result
+}
+
+/* runs op in a transaction on an in-memory SQLite database holding the schema and users 1 to 100 */
+func benchmarkLedger(b *testing.B,op func(Executor)) {
+	db, err := sql.Open("sqlite3",":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+	var executor = NewTxExecutor(tx,SQLiteDialect{})
+	if !CreateSchema(executor) {
+		b.Fatal("could not create schema")
+	}
+	for id := 1; id <= 100; id++ {
+		if !CreateUser(id)(executor) {
+			b.Fatalf("could not create user %v",id)
+		}
+	}
+	b.ResetTimer()
+	op(executor)
+}
+
+/* declared effects against the same flows with every leaf mutating */
+func benchmarkEffects(b *testing.B,flow func(int) Expr) {
+	for _, bench := range []struct {
+		name string
+		flow func(int) Expr
+	}{
+		{"savepoint",func(i int) Expr { return allMutating(flow(i)) }},
+		{"elided",flow},
+	} {
+		b.Run(bench.name,func(b *testing.B) {
+			benchmarkLedger(b,func(tx Executor) {
+				for i := 0; i < b.N; i++ {
+					if r := bench.flow(i).Compile()(context.Background(),tx); !r.Ok() {
+						b.Fatalf("iteration %v : %v",i,r)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkEnsureSender(b *testing.B) {
+	benchmarkEffects(b,func(i int) Expr {
+		return EnsureSenderExpr(Entry{i%100 + 1, 1, 10})
+	})
+}
+
+func BenchmarkProcessEntry(b *testing.B) {
+	benchmarkEffects(b,func(i int) Expr {
+		var entry = Entry{i%100 + 1, (i+1)%100 + 1, 1}
+		var save = Leaf("saveBatch",ExecuteSQL("INSERT INTO batch (Id,FromId,ToId,TransferAmount) VALUES (?,?,?,?)",i + 1,entry.FromId,entry.ToId,entry.TransferAmount))
+		return AndExpr(save,ProcessEntryExpr(i + 1,entry))
+	})
+}
+
+/* synthetic transactions, InvalidRatio of them transfer a non positive amount and are quarantined */
+type Workload struct {
+	Users        int
+	Entries      int
+	MaxAmount    int
+	InvalidRatio float64
+	Seed         int64
+}
+
+func (workload Workload) Generate() []Entry {
+	var random = rand.New(rand.NewSource(workload.Seed))
+	var entries = make([]Entry, workload.Entries)
+	for i := range entries {
+		var amount = random.Intn(workload.MaxAmount) + 1
+		if random.Float64() < workload.InvalidRatio {
+			amount = -random.Intn(workload.MaxAmount + 1)
+		}
+		entries[i] = Entry{random.Intn(workload.Users) + 1, random.Intn(workload.Users) + 1, amount}
+	}
+	return entries
+}
+
+func (workload Workload) String() string {
+	return fmt.Sprintf("users=%d/entries=%d/invalid=%v",workload.Users,workload.Entries,workload.InvalidRatio)
+}
+
+func TestWorkload(t *testing.T) {
+	var workload = Workload{Users: 5, Entries: 1000, MaxAmount: 50, InvalidRatio: 0.2, Seed: 1}
+	var entries = workload.Generate()
+	var invalid = 0
+	for _, entry := range entries {
+		if entry.FromId < 1 || entry.FromId > 5 || entry.ToId < 1 || entry.ToId > 5 || entry.TransferAmount > 50 {
+			t.Fatalf("workload : entry out of range %v",entry)
+		}
+		if !PositiveTransfer(entry)(nil) {
+			invalid++
+		}
+	}
+	if invalid < 150 || invalid > 250 {
+		t.Errorf("workload : expected about 200 invalid entries got %v",invalid)
+	}
+	if fmt.Sprint(workload.Generate()) != fmt.Sprint(entries) {
+		t.Errorf("workload : expected the same entries for the same seed")
+	}
+}
+
+var benchmarkWorkloads = []Workload{
+	{Users: 10, Entries: 100, MaxAmount: 20, InvalidRatio: 0, Seed: 1},
+	{Users: 100, Entries: 1000, MaxAmount: 20, InvalidRatio: 0.1, Seed: 1},
+	{Users: 1000, Entries: 1000, MaxAmount: 200, InvalidRatio: 0.5, Seed: 1},
+}
+
+/* times SaveBatch and BatchEntry on a new database for every iteration, the batch must be emptied */
+func benchmarkBatch(b *testing.B,dsn func() string) {
+	for _, workload := range benchmarkWorkloads {
+		var entries = workload.Generate()
+		b.Run(workload.String(),func(b *testing.B) {
+			var timed = func(tx Executor) bool {
+				b.StartTimer()
+				defer b.StopTimer()
+				return And(SaveBatch(entries),BatchEntry)(tx)
+			}
+			b.StopTimer()
+			for i := 0; i < b.N; i++ {
+				var report = EvalOpen(context.Background(),"sqlite3",dsn(),LiftContext(And(CreateSchema,timed,countRows("batch",0))))
+				if report.Err != nil || !report.Result.Ok() {
+					b.Fatalf("%v : %v",workload,report)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(entries))/b.Elapsed().Seconds(),"entries/s")
+		})
+	}
+}
+
+func BenchmarkBatchEntryMemory(b *testing.B) {
+	benchmarkBatch(b,func() string { return ":memory:" })
+}
+
+func BenchmarkBatchEntryFile(b *testing.B) {
+	var dir = b.TempDir()
+	var count = 0
+	benchmarkBatch(b,func() string {
+		count++
+		return filepath.Join(dir,fmt.Sprintf("kat_%d.db",count))
+	})
+}
+
+func TestCreateBatchDialect(t *testing.T) {
+	for _, dialect := range []Dialect{SQLiteDialect{},PostgresDialect{},MySQLDialect{}} {
+		var fake = NewFakeExecutor()
+		if r := LiftContext(CreateBatch)(WithDialect(context.Background(),dialect),fake); !r.Ok() {
+			t.Fatalf("create batch : %v got %v",dialect.Name(),r)
+		}
+		if queries := fake.Queries(); len(queries) != 1 || !strings.Contains(queries[0],dialect.AutoIncrement("Id")) {
+			t.Errorf("create batch : expected %v got %v",dialect.AutoIncrement("Id"),queries)
+		}
+	}
+}